@@ -5,8 +5,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,20 +15,36 @@ import (
 
 // EventData - A data structure that contains information about the current chat event.
 type EventData struct {
-	ChannelId   string    `json:"channelId"`
-	Event       string    `json:"event"`
-	Body        string    `json:"body"`
-	UserCount   int32     `json:"userCount"`
-	Name        string    `json:"name"`
-	CreatedDate time.Time `json:"createdDate"`
+	Id          string          `json:"id,omitempty"`
+	ChannelId   string          `json:"channelId"`
+	Event       string          `json:"event"`
+	Body        string          `json:"body"`
+	UserCount   int32           `json:"userCount"`
+	Name        string          `json:"name"`
+	CreatedDate time.Time       `json:"createdDate"`
+	Reactions   []reactionCount `json:"reactions,omitempty"`
+	ParentId    string          `json:"parentId,omitempty"`
+	ReplyCount  int             `json:"replyCount,omitempty"`
+	Mentions    []string        `json:"mentions,omitempty"`
+	To          string          `json:"to,omitempty"`
+	Format      string          `json:"format,omitempty"`
+	Html        string          `json:"html,omitempty"`
+	Emoji       []customEmoji   `json:"emoji,omitempty"`
+	Attachments []attachment    `json:"attachments,omitempty"`
+	Previews    []linkPreview   `json:"previews,omitempty"`
 }
 
-type messageFn func (user *User, jsonResponse []byte) func(key any, value any) bool
+type messageFn func (user *User, jsonResponse []byte, content bool) func(key any, value any) bool
 
-func getEvent(event string) (func(string, *User), bool) {
-	var events = map[string]func(string, *User){
-		EventTyping: handleTypingEvent,
-		EventMessage: handleMessageEvent,
+func getEvent(event string) (func(EventData, *User), bool) {
+	var events = map[string]func(EventData, *User){
+		EventTyping:      handleTypingEvent,
+		EventMessage:     handleMessageEvent,
+		EventReaction:    handleReactionEvent,
+		EventReply:       handleReplyEvent,
+		EventThread:      handleThreadEvent,
+		EventRead:        handleReadEvent,
+		EventMessagePart: handleMessagePartEvent,
 	}
 	eventFn, ok := events[event]
 	return eventFn, ok
@@ -44,6 +59,7 @@ var UserCount int32
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	CheckOrigin:     checkOrigin,
 }
 
 func removeUser(user *User) {
@@ -51,6 +67,19 @@ func removeUser(user *User) {
 	atomic.AddInt32(&UserCount, -1)
 }
 
+// findUserByName - A connected user with the given name, or nil. Case insensitive.
+func findUserByName(name string) *User {
+	var found *User
+	Users.Range(func(key, value interface{}) bool {
+		if strings.EqualFold(value.(*User).Name, name) {
+			found = value.(*User)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
 func replyMustBeLoggedIn() error {
 	return errors.New("must be logged in for that command to work")
 }
@@ -107,24 +136,37 @@ func sendMultipleMessages(user *User, body string, eventType string, displayName
 	} else {
 		name = user.Name
 	}
-	response = EventData{Event: eventType, ChannelId: user.CurrentChannelId, Body: body, Name: name, UserCount: UserCount, CreatedDate: time.Now()}
+	response = EventData{Id: newMessageId(), Event: eventType, ChannelId: user.CurrentChannelId, Body: body, Name: name, UserCount: UserCount, CreatedDate: time.Now()}
+	sendEventData(user, response, updateHistory, filterFn)
+}
+
+// send an already built event using the provided filterFunction. Events that go to the history are also kept in the message cache.
+// Events without a name are notices from the system, everything else is chat content.
+func sendEventData(user *User, response EventData, updateHistory bool, filterFn messageFn) {
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
-		log.Print("sendMultipleMessages():", err)
+		log.Print("sendEventData():", err)
 	}
-	if updateHistory {
+	if updateHistory && !user.isShadowBanned() {
 		updateChatHistory(jsonResponse)
+		sentMessages.add(response)
 	}
-	fn := filterFn(user, jsonResponse)
+	fn := filterFn(user, jsonResponse, response.Name != SystemName)
 	Users.Range(fn)
 }
 
-func newChatConnection(connection *websocket.Conn, cookie string) {
+func newChatConnection(connection *websocket.Conn, cookie string, ip string) {
 	log.Print("newChatConnection():", "Connection opened.")
 	var validationRes tokenValidationRes
 	var err error
 	var newUser User
 	var isClosed = false
+	var started = false
+	defer func() {
+		if !started {
+			releaseConnection(ip)
+		}
+	}()
 
 	if cookie != "" {
 		Users.Range(func(key, value interface{}) bool {
@@ -147,12 +189,24 @@ func newChatConnection(connection *websocket.Conn, cookie string) {
 			return
 		}
 	}
-	nano := strconv.Itoa(int(time.Now().UnixNano()))
 	if len(validationRes.Username) > 0 {
-		newUser = User{Name: validationRes.Username, CurrentChannelId: validationRes.DefaultChannel, Connection: connection, Token: cookie}
+		newUser = User{Name: validationRes.Username, account: validationRes.Username, CurrentChannelId: validationRes.DefaultChannel, Connection: connection, Token: cookie, messageBucket: loadFloodPolicy().newMessageBucket()}
 	} else {
-		newUser = User{Name: "Anon" + nano, Connection: connection, Token: cookie}
+		policy := loadGuestPolicy()
+		if !policy.enabled {
+			sendSystemMessage("Guests are not allowed. Please log in.", &User{Connection: connection}, EventErrorNotification)
+			connection.Close()
+			log.Print("newChatConnection(): Guests are disabled. Connection closed.")
+			return
+		}
+		guestName := policy.newGuestName()
+		newUser = User{Name: guestName, account: guestName, Connection: connection, messageBucket: policy.newMessageBucket()}
 	}
+	newUser.IP = ip
+	newUser.connectedSince = time.Now()
+	newUser.presence.lastActivity = newUser.connectedSince
+	applyShadowBan(&newUser)
+	loadIgnoreList(&newUser)
 	Users.Store(&newUser, &newUser)
 	atomic.AddInt32(&UserCount, 1)
 	sendToOtherEverywhere(newUser.Name+" has connected.", &newUser, EventNotification, false, false)
@@ -160,6 +214,7 @@ func newChatConnection(connection *websocket.Conn, cookie string) {
 	if len(newUser.Token) > 0 {
 		sendSystemMessage("Logged in successfully.", &newUser, EventLogin)
 	}
+	started = true
 	go reader(&newUser)
 	go heartbeat(&newUser)
 }
@@ -190,11 +245,18 @@ func reader(user *User) {
 		key, _ := Users.Load(user)
 		user := key.(*User)
 		removeUser(user)
+		pruneChannel(user.CurrentChannelId)
+		releaseConnection(user.IP)
+		recordDisconnect(user)
 		sendToAll(user.Name+" has disconnected.", user, EventNotification, false, false)
 	}()
-	user.Connection.SetReadLimit(maxMessageSize)
+	user.Connection.SetReadLimit(maxFrameSize)
 	user.Connection.SetReadDeadline(time.Now().Add(pongWait))
-	user.Connection.SetPongHandler(func(string) error { user.Connection.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	user.Connection.SetPongHandler(func(string) error {
+		user.Connection.SetReadDeadline(time.Now().Add(pongWait))
+		user.checkIdle()
+		return nil
+	})
 	for {
 		var EventData EventData
 		messageType, message, readerError := user.Connection.ReadMessage()
@@ -211,27 +273,43 @@ func reader(user *User) {
 				log.Println("event not recognized")
 				return
 			}
-			eventFn(EventData.Body, user)
+			user.markActive()
+			eventFn(EventData, user)
 		}
 	}
 }
 
 // ChatRequest - A chat request.
 func chatRequest(responseWriter http.ResponseWriter, request *http.Request) {
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		allowedOrigin, found := os.LookupEnv("ALLOWED_ORIGIN")
-		if found {
-			return r.Header.Get("Origin") == "http://"+allowedOrigin ||
-				r.Header.Get("Origin") == "https://"+allowedOrigin ||
-				r.Header.Get("Origin") == "https://www."+allowedOrigin ||
-				r.Header.Get("Origin") == "http://www."+allowedOrigin
+	ip := clientIP(request)
+	session := sessionCookie(request)
+	var responseHeader http.Header
+	if hasSessionWithoutCSRFCookie(request) {
+		// The session can not be used without a token, so the user joins as a guest and gets a csrf cookie.
+		// The client can then reconnect with the token instead of being locked out.
+		csrfToken, err := newCSRFToken()
+		if err != nil {
+			log.Print("ChatRequest():", err)
+			http.Error(responseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
 		}
-		return true
+		responseHeader = http.Header{"Set-Cookie": []string{csrfCookieName + "=" + csrfToken + cookieAttributes()}}
+		session = ""
+	} else if !validCSRFToken(request, request.URL.Query().Get(csrfQueryParameter)) {
+		log.Print("ChatRequest(): Rejected handshake without a valid csrf token from ", ip)
+		http.Error(responseWriter, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if status, err := acquireConnection(ip); err != nil {
+		log.Print("ChatRequest(): Rejected connection from ", ip, ": ", err)
+		http.Error(responseWriter, http.StatusText(status), status)
+		return
 	}
-	wsConnection, err := upgrader.Upgrade(responseWriter, request, nil)
+	wsConnection, err := upgrader.Upgrade(responseWriter, request, responseHeader)
 	if err != nil {
+		releaseConnection(ip)
 		log.Print("ChatRequest():", err)
 	} else {
-		newChatConnection(wsConnection, request.Header.Get("Cookie"))
+		newChatConnection(wsConnection, session, ip)
 	}
 }
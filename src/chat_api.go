@@ -20,6 +20,17 @@ type apiRequestOptions struct {
 
 type responseFn func([]byte) []byte
 
+// apiStatusError - The backend answered with something else than 200 OK.
+type apiStatusError struct {
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *apiStatusError) Error() string {
+	return "Error response: " + e.url + " " + e.status
+}
+
 func newApiRequestOptions(params *apiRequestOptions) apiRequestOptions {
 	a := apiRequestOptions{headers: map[string]string{}}
 	if params == nil {
@@ -72,7 +83,7 @@ func httpRequest(method string, url string, requestOptions apiRequestOptions, su
 		return nil, genericError()
 	}
 	if apiResponse != nil && apiResponse.Status != "200 OK" {
-		errorResponse := errors.New("Error response: " + url + " " + apiResponse.Status)
+		errorResponse := &apiStatusError{url: url, status: apiResponse.Status, statusCode: apiResponse.StatusCode}
 		log.Print("apiRequest():", errorResponse)
 		return nil, errorResponse
 	}
@@ -103,6 +114,10 @@ func apiLoginRequest(email string, password string) (res gatewayDTO, err error)
 	jsonResponse, _ := json.Marshal(chatloginRequest)
 	options := newApiRequestOptions(&apiRequestOptions{payload: jsonResponse})
 	body, err := gatewayApiRequest("POST", options, "CHAT_LOGIN_URL", nil)
+	var statusErr *apiStatusError
+	if errors.As(err, &statusErr) && statusErr.statusCode >= 400 && statusErr.statusCode < 500 {
+		return gatewayRes, errInvalidCredentials
+	}
 	if err != nil {
 		log.Print("apiLoginRequest():", err)
 		return gatewayRes, err
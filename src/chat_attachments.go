@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// maxAttachmentsPerMessage - How many files one message can have.
+const maxAttachmentsPerMessage = 4
+
+// thumbnailSize - The longer side of a thumbnail in pixels.
+const thumbnailSize = 256
+
+// maxImagePixels - Larger images are stored but get no thumbnail. A decoded image takes four bytes a pixel.
+const maxImagePixels = 16000000
+
+// thumbnailSlots - How many images can be decoded for thumbnails at the same time.
+var thumbnailSlots = make(chan struct{}, 2)
+
+// maxFileNameLength - Longer file names are cut.
+const maxFileNameLength = 128
+
+// attachmentsPath - Where the uploaded files are served from, followed by the id of the file.
+const attachmentsPath = "/api/v1/http/chat/attachments/"
+
+const thumbnailSuffix = ".thumb"
+const metadataSuffix = ".json"
+
+// attachmentStorage - Where the uploaded files and their thumbnails and metadata are kept.
+var attachmentStorage fileStorage = newLocalStorage("uploads")
+
+// attachment - An uploaded file. Messages refer to attachments by id.
+type attachment struct {
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	ChannelId   string    `json:"channelId"`
+	Uploader    string    `json:"uploader"`
+	Thumbnail   bool      `json:"thumbnail"`
+	Used        bool      `json:"used,omitempty"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// uploadPolicy - Upload limits. See env/README.md.
+type uploadPolicy struct {
+	maxBytes     int
+	quotaBytes   int
+	orphanMaxAge time.Duration
+	allowedTypes map[string]bool
+}
+
+// uploadRateLimiter - Locks out users who upload too many files in a short time. Read from UPLOADS_PER_MINUTE.
+var uploadRateLimiter = newAttemptLimiter(10, time.Minute, time.Minute)
+
+// uploadUsage - How many bytes a user has uploaded since the start of their quota day.
+type uploadUsage struct {
+	bytes int
+	since time.Time
+}
+
+var uploadUsageMutex sync.Mutex
+var uploadUsages = map[string]*uploadUsage{}
+
+var defaultUploadTypes = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"
+
+func initAttachments() {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		attachmentStorage = newLocalStorage(dir)
+	}
+	uploadRateLimiter = newAttemptLimiter(getEnvInt("UPLOADS_PER_MINUTE", 10), time.Minute, time.Minute)
+	go collectOrphanAttachments()
+	log.Print("initAttachments():", "Attachment storage ready.")
+}
+
+func loadUploadPolicy() uploadPolicy {
+	policy := uploadPolicy{maxBytes: getEnvInt("MAX_UPLOAD_BYTES", 5*1024*1024), quotaBytes: getEnvInt("UPLOAD_QUOTA_BYTES", 50*1024*1024),
+		orphanMaxAge: time.Duration(getEnvInt("ORPHAN_UPLOAD_MINUTES", 60)) * time.Minute, allowedTypes: map[string]bool{}}
+	types := os.Getenv("ALLOWED_UPLOAD_TYPES")
+	if types == "" {
+		types = defaultUploadTypes
+	}
+	for _, contentType := range strings.Split(types, ",") {
+		policy.allowedTypes[strings.TrimSpace(contentType)] = true
+	}
+	return policy
+}
+
+// detectContentType - The mime type of the file from its content, without parameters.
+func detectContentType(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// cleanFileName - The name of the uploaded file without its path and control characters.
+func cleanFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = string(runes[:maxFileNameLength])
+	}
+	return name
+}
+
+// reserveUploadQuota - Counts the bytes against the quota of the account for the day. False if they do not fit.
+func reserveUploadQuota(name string, size int, quota int) bool {
+	uploadUsageMutex.Lock()
+	defer uploadUsageMutex.Unlock()
+	now := time.Now()
+	for key, usage := range uploadUsages {
+		if now.Sub(usage.since) > 24*time.Hour {
+			delete(uploadUsages, key)
+		}
+	}
+	usage, ok := uploadUsages[name]
+	if !ok {
+		usage = &uploadUsage{since: now}
+		uploadUsages[name] = usage
+	}
+	if usage.bytes+size > quota {
+		return false
+	}
+	usage.bytes += size
+	return true
+}
+
+// makeThumbnail - A png that fits in thumbnailSize. Fails for content that is not a png, jpeg or gif or is too large.
+func makeThumbnail(data []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, errors.New("image too large for a thumbnail")
+	}
+	thumbnailSlots <- struct{}{}
+	defer func() { <-thumbnailSlots }()
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			width, height = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			width, height = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(thumbnail, thumbnail.Bounds(), source, bounds.Min, draw.Src)
+	} else {
+		// Nearest neighbour is good enough for a preview.
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				thumbnail.Set(x, y, source.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, thumbnail); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+// storeAttachment - Saves the file, its thumbnail and its metadata.
+func storeAttachment(file attachment, data []byte) (attachment, error) {
+	if err := attachmentStorage.save(file.Id, bytes.NewReader(data)); err != nil {
+		return file, err
+	}
+	if strings.HasPrefix(file.ContentType, "image/") {
+		if thumbnail, err := makeThumbnail(data); err == nil {
+			file.Thumbnail = attachmentStorage.save(file.Id+thumbnailSuffix, bytes.NewReader(thumbnail)) == nil
+		}
+	}
+	metadata, err := json.Marshal(file)
+	if err != nil {
+		return file, err
+	}
+	if err := attachmentStorage.save(file.Id+metadataSuffix, bytes.NewReader(metadata)); err != nil {
+		attachmentStorage.remove(file.Id)
+		return file, err
+	}
+	return file, nil
+}
+
+// markAttachmentUsed - Keeps the file from being collected as an orphan once a message or an emoji uses it.
+func markAttachmentUsed(file attachment) {
+	if file.Used {
+		return
+	}
+	file.Used = true
+	metadata, err := json.Marshal(file)
+	if err == nil {
+		err = attachmentStorage.save(file.Id+metadataSuffix, bytes.NewReader(metadata))
+	}
+	if err != nil {
+		log.Print("markAttachmentUsed():", err)
+	}
+}
+
+// removeOrphanAttachments - Removes the uploads that nothing has used and that are older than the max age.
+func removeOrphanAttachments(maxAge time.Duration) {
+	keys, err := attachmentStorage.list()
+	if err != nil {
+		log.Print("removeOrphanAttachments():", err)
+		return
+	}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, metadataSuffix) {
+			continue
+		}
+		file, err := getAttachment(strings.TrimSuffix(key, metadataSuffix))
+		if err != nil || file.Used || time.Since(file.CreatedDate) < maxAge {
+			continue
+		}
+		attachmentStorage.remove(file.Id)
+		attachmentStorage.remove(file.Id + thumbnailSuffix)
+		if err := attachmentStorage.remove(key); err != nil {
+			log.Print("removeOrphanAttachments():", err)
+		}
+	}
+}
+
+func collectOrphanAttachments() {
+	for {
+		time.Sleep(10 * time.Minute)
+		removeOrphanAttachments(loadUploadPolicy().orphanMaxAge)
+	}
+}
+
+// getAttachment - The metadata of an uploaded file.
+func getAttachment(id string) (attachment, error) {
+	var file attachment
+	reader, err := attachmentStorage.open(id + metadataSuffix)
+	if err != nil {
+		return file, err
+	}
+	defer reader.Close()
+	err = json.NewDecoder(reader).Decode(&file)
+	return file, err
+}
+
+// resolveAttachments - The attachments a message of the user refers to. Users can only attach the uploads of their
+// account, and only on the channel they were uploaded to. Guests can not upload so they have nothing to attach.
+func resolveAttachments(references []attachment, user *User) ([]attachment, error) {
+	if len(references) > maxAttachmentsPerMessage {
+		return nil, errors.New("a message can have at most " + strconv.Itoa(maxAttachmentsPerMessage) + " attachments")
+	}
+	var files []attachment
+	for _, reference := range references {
+		file, err := getAttachment(reference.Id)
+		if err != nil || user.isGuest() || file.Uploader != user.accountName() || file.ChannelId != user.CurrentChannelId {
+			return nil, errors.New("no such attachment")
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// hasChannelAccess - Everyone can see the public channel. Other channels need a user the backend lets in.
+func hasChannelAccess(user *User, channelId string) bool {
+	if channelId == "" {
+		return true
+	}
+	if user == nil || user.isGuest() {
+		return false
+	}
+	_, err := readChannel(user, channelId)
+	return err == nil
+}
+
+// uploadRequest - POST a multipart form with the file in the "file" field. The channel the file is shared on is the
+// channelId query parameter, empty for the public channel. Answers with the attachment to refer to in a message.
+func uploadRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	user, ok := requestUser(responseWriter, request)
+	if !ok {
+		return
+	}
+	channelId := request.URL.Query().Get("channelId")
+	if !hasChannelAccess(user, channelId) {
+		writeJSONError(responseWriter, http.StatusForbidden, ErrorCodeForbidden, "no access to that channel")
+		return
+	}
+	if retryAfter, locked := uploadRateLimiter.locked(user.accountName()); locked {
+		writeTooManyAttempts(responseWriter, retryAfter)
+		return
+	}
+	uploadRateLimiter.add(user.accountName())
+	policy := loadUploadPolicy()
+	request.Body = http.MaxBytesReader(responseWriter, request.Body, int64(policy.maxBytes)+maxRequestBodySize*64)
+	reader, err := request.MultipartReader()
+	if err != nil {
+		writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "malformed request")
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "no file in the request")
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, int64(policy.maxBytes)+1))
+		if err != nil {
+			writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "malformed request")
+			return
+		}
+		if len(data) > policy.maxBytes {
+			writeJSONError(responseWriter, http.StatusRequestEntityTooLarge, ErrorCodeTooLarge, "the file can be at most "+strconv.Itoa(policy.maxBytes)+" bytes")
+			return
+		}
+		contentType := detectContentType(data)
+		if len(data) == 0 || !policy.allowedTypes[contentType] {
+			writeJSONError(responseWriter, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedType, "files of that type can not be uploaded")
+			return
+		}
+		if !reserveUploadQuota(user.accountName(), len(data), policy.quotaBytes) {
+			writeJSONError(responseWriter, http.StatusRequestEntityTooLarge, ErrorCodeTooLarge, "you have used your upload quota for today")
+			return
+		}
+		file, err := storeAttachment(attachment{Id: newMessageId(), Name: cleanFileName(part.FileName()), ContentType: contentType,
+			Size: len(data), ChannelId: channelId, Uploader: user.accountName(), CreatedDate: time.Now()}, data)
+		if err != nil {
+			log.Print("uploadRequest():", err)
+			writeJSONError(responseWriter, http.StatusInternalServerError, ErrorCodeServerError, "the file could not be saved")
+			return
+		}
+		writeJSON(responseWriter, http.StatusCreated, file)
+		return
+	}
+}
+
+// downloadRequest - GET /attachments/<id> serves the file and /attachments/<id>?thumbnail=true its thumbnail.
+// Files of channels other than the public one are only served to users who can see the channel.
+func downloadRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	id := request.URL.Path[strings.LastIndex(request.URL.Path, "/")+1:]
+	file, err := getAttachment(id)
+	if err != nil {
+		writeJSONError(responseWriter, http.StatusNotFound, ErrorCodeNotFound, "no such attachment")
+		return
+	}
+	if file.ChannelId != "" {
+		user, ok := requestUser(responseWriter, request)
+		if !ok {
+			return
+		}
+		if !hasChannelAccess(user, file.ChannelId) {
+			writeJSONError(responseWriter, http.StatusNotFound, ErrorCodeNotFound, "no such attachment")
+			return
+		}
+	}
+	key, contentType := file.Id, file.ContentType
+	if request.URL.Query().Get("thumbnail") == "true" {
+		if !file.Thumbnail {
+			writeJSONError(responseWriter, http.StatusNotFound, ErrorCodeNotFound, "that attachment has no thumbnail")
+			return
+		}
+		key, contentType = file.Id+thumbnailSuffix, "image/png"
+	}
+	reader, err := attachmentStorage.open(key)
+	if err != nil {
+		log.Print("downloadRequest():", err)
+		writeJSONError(responseWriter, http.StatusNotFound, ErrorCodeNotFound, "no such attachment")
+		return
+	}
+	defer reader.Close()
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+	responseWriter.Header().Set("Content-Type", contentType)
+	responseWriter.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	responseWriter.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	responseWriter.Header().Set("Cache-Control", "private, max-age=86400")
+	if _, err := io.Copy(responseWriter, reader); err != nil {
+		log.Print("downloadRequest():", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadTestFile(name string, content []byte, channelId string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", name)
+	part.Write(content)
+	writer.Close()
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/http/chat/attachments?channelId="+channelId, &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-alice"})
+	recorder := httptest.NewRecorder()
+	uploadRequest(recorder, request)
+	return recorder
+}
+
+func TestStorageKeys(t *testing.T) {
+	storage := newLocalStorage(t.TempDir())
+	assert.Equal(t, errInvalidStorageKey, storage.save("../escape", bytes.NewReader(nil)))
+	assert.Nil(t, storage.save("abc123.json", bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, "x.png", cleanFileName("../../x.png"))
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	defer setupLogin(t)()
+	attachmentStorage = newLocalStorage(t.TempDir())
+	os.Setenv("MAX_UPLOAD_BYTES", "10000")
+	defer os.Unsetenv("MAX_UPLOAD_BYTES")
+
+	var picture bytes.Buffer
+	png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 600, 300)))
+	recorder := uploadTestFile("C:\\shots\\screen.png", picture.Bytes(), "")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var file attachment
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &file))
+	assert.Equal(t, "screen.png", file.Name)
+	assert.Equal(t, "image/png", file.ContentType)
+	assert.Equal(t, "alice", file.Uploader)
+	assert.True(t, file.Thumbnail)
+
+	recorder = httptest.NewRecorder()
+	downloadRequest(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/http/chat/attachments/"+file.Id+"?thumbnail=true", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	thumbnail, err := png.DecodeConfig(recorder.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, thumbnailSize, thumbnail.Width)
+	assert.Equal(t, thumbnailSize/2, thumbnail.Height)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, uploadTestFile("evil.png", []byte("<html><script>alert(1)</script></html>"), "").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, uploadTestFile("big.txt", bytes.Repeat([]byte("a"), 10001), "").Code)
+
+	recorder = httptest.NewRecorder()
+	downloadRequest(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/http/chat/attachments/../../etc/passwd", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestUploadQuotaAndOrphans(t *testing.T) {
+	assert.True(t, reserveUploadQuota("quota-user", 600, 1000))
+	assert.False(t, reserveUploadQuota("quota-user", 600, 1000))
+	assert.True(t, reserveUploadQuota("other-user", 600, 1000))
+
+	attachmentStorage = newLocalStorage(t.TempDir())
+	orphan, err := storeAttachment(attachment{Id: "aa", Name: "a.txt", ContentType: "text/plain", CreatedDate: time.Now().Add(-2 * time.Hour)}, []byte("a"))
+	assert.Nil(t, err)
+	used, err := storeAttachment(attachment{Id: "bb", Name: "b.txt", ContentType: "text/plain", CreatedDate: time.Now().Add(-2 * time.Hour)}, []byte("b"))
+	assert.Nil(t, err)
+	markAttachmentUsed(used)
+	_, err = storeAttachment(attachment{Id: "cc", Name: "c.txt", ContentType: "text/plain", CreatedDate: time.Now()}, []byte("c"))
+	assert.Nil(t, err)
+
+	removeOrphanAttachments(time.Hour)
+	_, err = getAttachment(orphan.Id)
+	assert.NotNil(t, err, "Old uploads nothing uses are removed.")
+	keys, _ := attachmentStorage.list()
+	assert.Equal(t, []string{"bb", "bb.json", "cc", "cc.json"}, keys)
+}
+
+func TestAttachmentsBelongToTheAccount(t *testing.T) {
+	defer setupLogin(t)()
+	attachmentStorage = newLocalStorage(t.TempDir())
+	recorder := uploadTestFile("notes.txt", []byte("mine"), "")
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var file attachment
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &file))
+
+	_, err := resolveAttachments([]attachment{{Id: file.Id}}, &User{Name: "renamed", account: "alice", Token: "token-alice"})
+	assert.Nil(t, err, "A new nick should not lose the uploads of the account.")
+	_, err = resolveAttachments([]attachment{{Id: file.Id}}, &User{Name: "alice", account: "thief", Token: "token-thief"})
+	assert.NotNil(t, err, "Taking the nick should not give the uploads.")
+	_, err = resolveAttachments([]attachment{{Id: file.Id}}, &User{Name: "alice", account: "alice"})
+	assert.NotNil(t, err, "Guests have no uploads.")
+}
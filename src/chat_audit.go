@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Moderation actions written to the audit log.
+const (
+	AuditNameChange    = "nameChange"
+	AuditKick          = "kick"
+	AuditDelete        = "delete"
+	AuditMute          = "mute"
+	AuditDisconnect    = "disconnect"
+	AuditSlowMode      = "slowMode"
+	AuditReport        = "report"
+	AuditReportResolve = "reportResolve"
+	AuditShadowBan     = "shadowBan"
+	AuditUnshadowBan   = "unshadowBan"
+	AuditBan           = "ban"
+	AuditUnban         = "unban"
+	AuditChannelEmoji  = "channelEmoji"
+	AuditMessageLimit  = "messageLimit"
+	AuditPin           = "pin"
+	AuditUnpin         = "unpin"
+)
+
+// AuditSystemActor - The actor of actions the server takes by itself.
+const AuditSystemActor = "system"
+
+// auditEntry - One line in the audit log.
+type auditEntry struct {
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	Target      string    `json:"target"`
+	ChannelId   string    `json:"channelId"`
+	Detail      string    `json:"detail"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+var auditMutex sync.Mutex
+
+// audit - Appends a moderation action to the audit log. The log is the file in AUDIT_LOG_FILE, one json entry per line.
+// Entries are never modified or removed. Without AUDIT_LOG_FILE the entries only go to the server log.
+func audit(action string, actor string, target string, channelId string, detail string) {
+	entry := auditEntry{Action: action, Actor: actor, Target: target, ChannelId: channelId, Detail: detail, CreatedDate: time.Now()}
+	jsonEntry, err := json.Marshal(entry)
+	if err != nil {
+		log.Print("audit():", err)
+		return
+	}
+	log.Print("audit(): ", string(jsonEntry))
+	path, found := os.LookupEnv("AUDIT_LOG_FILE")
+	if !found || path == "" {
+		return
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Print("audit():", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(jsonEntry, '\n')); err != nil {
+		log.Print("audit():", err)
+	}
+}
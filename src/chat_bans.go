@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type banListDTO struct {
+	Names []string `json:"names"`
+	IPs   []string `json:"ips"`
+}
+
+// banList - A set of banned user names and ip addresses. Addresses can also be CIDR ranges.
+// The list is persisted through the backend url in the env variable given to newBanList.
+type banList struct {
+	mutex    sync.RWMutex
+	names    map[string]bool
+	ips      map[string]bool
+	networks map[string]*net.IPNet
+	env      string
+}
+
+func newBanList(env string) *banList {
+	return &banList{names: map[string]bool{}, ips: map[string]bool{}, networks: map[string]*net.IPNet{}, env: env}
+}
+
+// normalizeIP - Parses an address or a CIDR range. Returns the canonical form and the range if it is one.
+func normalizeIP(value string) (string, *net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", nil, errors.New("invalid ip range: " + value)
+		}
+		return network.String(), network, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", nil, errors.New("invalid ip address: " + value)
+	}
+	return ip.String(), nil, nil
+}
+
+func (b *banList) addName(name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.names[strings.ToLower(name)] = true
+}
+
+func (b *banList) removeName(name string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	name = strings.ToLower(name)
+	found := b.names[name]
+	delete(b.names, name)
+	return found
+}
+
+func (b *banList) addIP(value string) error {
+	normalized, network, err := normalizeIP(value)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if network != nil {
+		b.networks[normalized] = network
+	} else {
+		b.ips[normalized] = true
+	}
+	return nil
+}
+
+func (b *banList) removeIP(value string) bool {
+	normalized, _, err := normalizeIP(value)
+	if err != nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	_, foundNetwork := b.networks[normalized]
+	found := b.ips[normalized] || foundNetwork
+	delete(b.ips, normalized)
+	delete(b.networks, normalized)
+	return found
+}
+
+func (b *banList) hasName(name string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.names[strings.ToLower(name)]
+}
+
+func (b *banList) hasIP(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.ips[ip.String()] {
+		return true
+	}
+	for _, network := range b.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *banList) list() banListDTO {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	dto := banListDTO{Names: []string{}, IPs: []string{}}
+	for name := range b.names {
+		dto.Names = append(dto.Names, name)
+	}
+	for ip := range b.ips {
+		dto.IPs = append(dto.IPs, ip)
+	}
+	for network := range b.networks {
+		dto.IPs = append(dto.IPs, network)
+	}
+	sort.Strings(dto.Names)
+	sort.Strings(dto.IPs)
+	return dto
+}
+
+// load - Replaces the list with the persisted one. Does nothing if the backend can not be reached.
+func (b *banList) load() {
+	res, err := apiRequest("GET", newApiRequestOptions(nil), b.env, nil)
+	if err != nil {
+		log.Print("banList.load():", err)
+		return
+	}
+	var dto banListDTO
+	if err := json.Unmarshal(res, &dto); err != nil {
+		log.Print("banList.load():", err)
+		return
+	}
+	b.mutex.Lock()
+	b.names = map[string]bool{}
+	b.ips = map[string]bool{}
+	b.networks = map[string]*net.IPNet{}
+	b.mutex.Unlock()
+	for _, name := range dto.Names {
+		b.addName(name)
+	}
+	for _, ip := range dto.IPs {
+		if err := b.addIP(ip); err != nil {
+			log.Print("banList.load():", err)
+		}
+	}
+}
+
+// save - Persists the whole list.
+func (b *banList) save() error {
+	jsonResponse, err := json.Marshal(b.list())
+	if err != nil {
+		return err
+	}
+	_, err = apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), b.env, nil)
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBanList(t *testing.T) {
+	bans := newBanList("CHAT_TEST_BAN_URL")
+	bans.addName("Spammer")
+	assert.Nil(t, bans.addIP("10.0.0.1"))
+	assert.Nil(t, bans.addIP("192.168.1.0/24"))
+	assert.NotNil(t, bans.addIP("not an address"))
+
+	assert.True(t, bans.hasName("spammer"))
+	assert.True(t, bans.hasIP("10.0.0.1"))
+	assert.True(t, bans.hasIP("192.168.1.77"))
+	assert.False(t, bans.hasIP("192.168.2.1"))
+	assert.False(t, bans.hasIP(""))
+	assert.Equal(t, banListDTO{Names: []string{"spammer"}, IPs: []string{"10.0.0.1", "192.168.1.0/24"}}, bans.list())
+
+	assert.True(t, bans.removeIP("192.168.1.0/24"))
+	assert.False(t, bans.hasIP("192.168.1.77"))
+	assert.True(t, bans.removeName("SPAMMER"))
+	assert.False(t, bans.removeName("spammer"))
+}
+
+func TestShadowBannedMessagesOnlyReachTheSender(t *testing.T) {
+	spammer := &User{Name: "spammer", IP: "10.0.0.1"}
+	reader := &User{Name: "reader", IP: "10.0.0.2"}
+	shadowBans.addIP("10.0.0.1")
+	defer shadowBans.removeIP("10.0.0.1")
+	applyShadowBan(spammer)
+	applyShadowBan(reader)
+	assert.True(t, canDeliver(spammer, spammer, true))
+	assert.False(t, canDeliver(spammer, reader, true))
+	assert.True(t, canDeliver(reader, spammer, true))
+	assert.True(t, canDeliver(spammer, reader, false), "Notices about a shadow banned user would reveal the ban if they were hidden.")
+}
+
+func TestShadowBanFollowsNameChange(t *testing.T) {
+	user := &User{Name: "troll", Token: "token"}
+	shadowBans.addName("troll")
+	defer shadowBans.removeName("troll2")
+	applyShadowBan(user)
+	user.Name = "troll2"
+	carryShadowBan(user, "troll")
+	assert.True(t, shadowBans.hasName("troll2"))
+	assert.False(t, shadowBans.hasName("troll"))
+	reconnected := &User{Name: "troll2", Token: "token"}
+	applyShadowBan(reconnected)
+	assert.True(t, reconnected.isShadowBanned())
+}
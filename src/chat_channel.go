@@ -6,15 +6,19 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func getChannelCommand(command string) (func([]string, *User) error, bool) {
 	var commands = map[string]func([]string, *User) error{
-		"create":  handleChannelCreate,
-		"invite":  handleChannelInvite,
-		"join":    handleChannelJoin,
-		"list":    handleChannelList,
-		"default": handleChannelDefault,
+		"create":    handleChannelCreate,
+		"invite":    handleChannelInvite,
+		"join":      handleChannelJoin,
+		"list":      handleChannelList,
+		"default":   handleChannelDefault,
+		"slowmode":  handleChannelSlowMode,
+		"emoji":     handleChannelEmoji,
+		"maxlength": handleChannelMaxLength,
 	}
 	commandFn, ok := commands[command]
 	return commandFn, ok
@@ -71,24 +75,26 @@ func handleChannelJoin(commands []string, user *User) error {
 		return notEnoughParameters()
 	}
 	var parameter1 = commands[2]
-	var readResponse channelReadResponse
+	previousChannelId := user.CurrentChannelId
 	if len(parameter1) < 1 || parameter1 == PublicChannelName {
 		user.CurrentChannelId = ""
 		parameter1 = PublicChannelName
 	} else {
-		jsonResponse, err := json.Marshal(channelGenericDTO{CreatorToken: user.Token, ChannelId: parameter1})
+		if user.isGuest() && loadGuestPolicy().publicOnly {
+			return replyMustBeLoggedIn()
+		}
+		readResponse, err := readChannel(user, parameter1)
 		if err != nil {
 			log.Print("handleChannelJoin():", err)
 			return errors.New("error joining channel: '" + parameter1 + "'")
 		}
-		channelResponse, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_CHANNEL_LIST_URL", nil)
-		if err != nil {
-			return errors.New("error joining channel: '" + parameter1 + "'")
+		if user.isGuest() && readResponse.Private {
+			return replyMustBeLoggedIn()
 		}
-		json.Unmarshal(channelResponse, &readResponse)
 		user.CurrentChannelId = readResponse.Name
 	}
 	sendToOtherOnChannel(user.Name+" went looking for better content.", user, EventNotification, false, false)
+	pruneChannel(previousChannelId)
 	handleJoin(user)
 	sendSystemMessage("Succesfully joined channel '"+parameter1+"'", user, EventNotification)
 	return nil
@@ -104,7 +110,7 @@ func handleChannelList(params []string, user *User) error {
 	if err != nil {
 		return errors.New("error listing channels")
 	}
-	sendSystemMessage(string(channelResponse), user, EventChannelList)
+	sendSystemMessage(string(withUnreadCounts(channelResponse, user)), user, EventChannelList)
 	return nil
 }
 
@@ -123,4 +129,49 @@ func handleChannelDefault(params []string, user *User) error {
 	}
 	sendSystemMessage("Successfully set channel: '"+user.CurrentChannelId+"' as your default channel.", user, EventNotification)
 	return nil
-}
\ No newline at end of file
+}
+
+// handleChannelMaxLength - /channel maxlength <bytes> sets how long messages on the current channel can be. 0 goes back
+// to the defaults.
+func handleChannelMaxLength(params []string, user *User) error {
+	if len(params) != 3 {
+		return notEnoughParameters()
+	}
+	maxBytes, err := strconv.Atoi(params[2])
+	if err != nil || maxBytes < 0 || maxBytes > maxFrameSize/2 {
+		return errors.New("the message length limit must be between 0 and " + strconv.Itoa(maxFrameSize/2) + " bytes")
+	}
+	if !isChannelAdmin(user, user.CurrentChannelId) {
+		return replyMustBeChannelAdmin()
+	}
+	setChannelMessageLimit(user.CurrentChannelId, maxBytes)
+	audit(AuditMessageLimit, user.Name, "", user.CurrentChannelId, params[2]+" bytes")
+	if maxBytes == 0 {
+		sendToAllOnChannel("Messages on this channel have the default length limit again.", user, EventNotification, false, false)
+	} else {
+		sendToAllOnChannel("Messages on this channel can now be "+params[2]+" bytes long.", user, EventNotification, false, false)
+	}
+	return nil
+}
+
+// handleChannelSlowMode - /channel slowmode <seconds>. Channel admins only.
+func handleChannelSlowMode(params []string, user *User) error {
+	if len(params) != 3 {
+		return notEnoughParameters()
+	}
+	seconds, err := strconv.Atoi(params[2])
+	if err != nil || seconds < 0 || seconds > maxSlowModeSeconds {
+		return errors.New("slow mode must be between 0 and " + strconv.Itoa(maxSlowModeSeconds) + " seconds")
+	}
+	if !isChannelAdmin(user, user.CurrentChannelId) {
+		return replyMustBeChannelAdmin()
+	}
+	setSlowMode(user.CurrentChannelId, time.Duration(seconds)*time.Second)
+	audit(AuditSlowMode, user.Name, "", user.CurrentChannelId, params[2]+" seconds")
+	if seconds == 0 {
+		sendToAllOnChannel("Slow mode is now off.", user, EventNotification, false, false)
+	} else {
+		sendToAllOnChannel("Slow mode is now on. Everyone can send one message every "+params[2]+" seconds.", user, EventNotification, false, false)
+	}
+	return nil
+}
@@ -44,19 +44,38 @@ type channelReadResponse struct {
 
 func getCommand(command string) (func([]string, *User) error, bool) {
 	var commands = map[string]func([]string, *User) error{
-		CommandWho:        handleWhoCommand,
-		CommandNameChange: handleNameChangeCommand,
-		CommandHelp:       handleHelpCommand,
-		CommandChannel:    handleChannelCommand,
-		CommandWhereAmI:   handleWhereCommand,
+		CommandWho:           handleWhoCommand,
+		CommandNameChange:    handleNameChangeCommand,
+		CommandHelp:          handleHelpCommand,
+		CommandChannel:       handleChannelCommand,
+		CommandWhereAmI:      handleWhereCommand,
+		CommandReport:        handleReportCommand,
+		CommandReports:       handleReportsCommand,
+		CommandKick:          handleKickCommand,
+		CommandDelete:        handleDeleteCommand,
+		CommandIgnore:        handleIgnoreCommand,
+		CommandUnignore:      handleUnignoreCommand,
+		CommandShadowBan:     handleShadowBanCommand,
+		CommandUnshadowBan:   handleUnshadowBanCommand,
+		CommandBan:           handleBanCommand,
+		CommandUnban:         handleUnbanCommand,
+		CommandInbox:         handleInboxCommand,
+		CommandDirectMessage: handleDirectMessageCommand,
+		CommandAway:          handleAwayCommand,
+		CommandBusy:          handleBusyCommand,
+		CommandBack:          handleBackCommand,
+		CommandWhois:         handleWhoisCommand,
+		CommandSeen:          handleSeenCommand,
+		CommandPin:           handlePinCommand,
+		CommandUnpin:         handleUnpinCommand,
+		CommandPins:          handlePinsCommand,
 	}
 	commandFn, ok := commands[command]
 	return commandFn, ok
 }
 
 func handleCommand(body string, user *User) {
-	var splitBody = strings.Split(body, "/")
-	splitBody = strings.Split(splitBody[1], " ")
+	var splitBody = strings.Split(strings.TrimPrefix(body, "/"), " ")
 	command := splitBody[0]
 	commandFn, ok := getCommand(command)
 	if !ok {
@@ -74,8 +93,29 @@ func handleHelpCommand(_ []string, user *User) error {
 	var response []helpDTO
 	response = append(response, helpDTO{Desc: "This command", Name: CommandHelp})
 	response = append(response, helpDTO{Desc: "What channel are you on.", Name: CommandWhereAmI})
-	response = append(response, helpDTO{Desc: "Logged in users on this channel", Name: CommandWho})
-	response = append(response, helpDTO{Desc: "For channel operations. Available parameters are 'invite <channelName> <email>', 'create <channelName>.', 'default' that sets the current channel as your default, 'join <channelName>' and 'list'", Name: CommandChannel})
+	response = append(response, helpDTO{Desc: "Users on this channel, their role, presence and how long they have been connected and idle", Name: CommandWho})
+	response = append(response, helpDTO{Desc: "The profile of a user. Parameters: <nick>", Name: CommandWhois})
+	response = append(response, helpDTO{Desc: "When a user last sent a message and last left. Parameters: <nick>", Name: CommandSeen})
+	response = append(response, helpDTO{Desc: "For channel operations. Available parameters are 'invite <channelName> <email>', 'create <channelName>.', 'default' that sets the current channel as your default, 'join <channelName>', 'list', 'slowmode <seconds>' that limits how often everyone can send messages on the current channel (0 turns it off), 'emoji add <name> <attachmentId>', 'emoji remove <name>' or 'emoji list' for the custom emoji of the current channel and 'maxlength <bytes>' that sets how long messages on the current channel can be (0 goes back to the default)", Name: CommandChannel})
+	response = append(response, helpDTO{Desc: "Report a message to the moderators. Parameters: <messageId> <reason>", Name: CommandReport})
+	response = append(response, helpDTO{Desc: "Admins only. Lists the open reports. 'resolve <reportId> <resolution>' resolves one", Name: CommandReports})
+	response = append(response, helpDTO{Desc: "Admins only. Disconnects a user. Parameters: <nick> <reason>", Name: CommandKick})
+	response = append(response, helpDTO{Desc: "Admins only. Deletes a message on the current channel. Parameters: <messageId>", Name: CommandDelete})
+	response = append(response, helpDTO{Desc: "Admins only. Hides the messages of a user from everyone but themselves. Parameters: <nick>, 'ip <address>' or 'list'", Name: CommandShadowBan})
+	response = append(response, helpDTO{Desc: "Admins only. Lifts a shadow ban. Parameters: <nick> or 'ip <address>'", Name: CommandUnshadowBan})
+	response = append(response, helpDTO{Desc: "Admins only. Bans the address a user is connected from and disconnects everyone on it. Parameters: <nick>, 'ip <address>' or 'list'", Name: CommandBan})
+	response = append(response, helpDTO{Desc: "Admins only. Lifts an address ban. Parameters: 'ip <address>'", Name: CommandUnban})
+	response = append(response, helpDTO{Desc: "Stop seeing messages from a user. Parameters: <nick>, or 'list' to see who you are ignoring. Only persistent if you are registered and logged in", Name: CommandIgnore})
+	response = append(response, helpDTO{Desc: "Start seeing messages from an ignored user again. Parameters: <nick>", Name: CommandUnignore})
+	response = append(response, helpDTO{Desc: "Send a message only one user sees. Registered users who are offline get it in their inbox. Parameters: <nick> <message>", Name: CommandDirectMessage})
+	response = append(response, helpDTO{Desc: "Logged in users only. Lists the unread mentions, messages and invites you got while offline. 'all' lists the read ones too and 'read [id...]' marks them as read", Name: CommandInbox})
+	response = append(response, helpDTO{Desc: "Tell the others you are away. Parameters: [message]", Name: CommandAway})
+	response = append(response, helpDTO{Desc: "Tell the others you are busy", Name: CommandBusy})
+	response = append(response, helpDTO{Desc: "Clear away or busy", Name: CommandBack})
+	response = append(response, helpDTO{Desc: "Send an action, like '* nick waves'. Parameters: <action>", Name: CommandMe})
+	response = append(response, helpDTO{Desc: "Channel admins only. Pins a message on the current channel. Parameters: <messageId>", Name: CommandPin})
+	response = append(response, helpDTO{Desc: "Channel admins only. Unpins a message. Parameters: <messageId>", Name: CommandUnpin})
+	response = append(response, helpDTO{Desc: "The pinned messages of the current channel", Name: CommandPins})
 	response = append(response, helpDTO{Desc: "Change your name. Nickname is only persistent if you are registered and logged in. Parameters: <newName>'", Name: CommandNameChange})
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
@@ -104,7 +144,9 @@ func changeNameRequest(user *User, method string, env string, body string) error
 	jsonResponse, _ := json.Marshal(nameChangeDTO{Username: body, CreatorToken: user.Token})
 	_, err := apiRequest(method, newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), env, func(response []byte) []byte {
 		originalName := user.Name
+		audit(AuditNameChange, originalName, body, user.CurrentChannelId, "")
 		user.Name = body
+		carryShadowBan(user, originalName)
 		Users.Store(user, user)
 		sendSystemMessage(body, user, EventNameChange)
 		sendToOtherOnChannel(originalName+" is now called "+body, user, EventNotification, false, false)
@@ -131,6 +173,9 @@ func handleNameChangeCommand(splitBody []string, u *User) error {
 		if user.Name == body {
 			return errors.New("you already have that nickname")
 		}
+		if loadGuestPolicy().isReservedName(body) {
+			return errors.New("that name is reserved")
+		}
 		if len(user.Token) > 0 {
 			if err := changeNameRequest(user, "PUT", "CHAT_CHANGE_NICKNAME", body); err != nil {
 				return errors.New("names must be unique")
@@ -151,7 +196,7 @@ func handleNameChangeCommand(splitBody []string, u *User) error {
 func handleChannelCommand(commands []string, user *User) error {
 	if len(commands) >= 2 {
 		var subCommand = commands[1]
-		if len(user.Token) > 0 {
+		if len(user.Token) > 0 || subCommand == "join" {
 			commandFn, ok := getChannelCommand(subCommand)
 			if (!ok) {
 				return notEnoughParameters()
@@ -171,11 +216,12 @@ func HandleUserCommand(commands []string, connection *websocket.Conn) {
 
 // handleWhoCommand - who is present in the current channel
 func handleWhoCommand(_ []string, user *User) error {
-	var whoIsHere []string
+	var whoIsHere []whoDTO
+	channelAdmin := channelAdminName(user, user.CurrentChannelId)
 	Users.Range(func(key, value interface{}) bool {
 		v := value.(*User)
 		if user.CurrentChannelId == v.CurrentChannelId {
-			whoIsHere = append(whoIsHere, v.Name)
+			whoIsHere = append(whoIsHere, newWhoDTO(v, channelAdmin))
 		}
 		return true
 	})
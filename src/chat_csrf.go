@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+// The session cookie carries the login token and is not readable by scripts.
+const sessionCookieName = "session"
+
+// The csrf cookie is readable by the client so that it can echo it back. A cross-site page can not read it,
+// which is what makes the double-submit check work.
+const csrfCookieName = "csrf"
+
+// Http requests send the csrf token in this header. The websocket handshake can not set headers so it uses the query parameter instead.
+const csrfHeaderName = "X-CSRF-Token"
+const csrfQueryParameter = "csrf"
+
+func newCSRFToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func cookieValue(request *http.Request, name string) string {
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// sessionCookie - The session cookie in the same "session=<token>" form the backend has always received it in.
+// Other cookies sent along are left out.
+func sessionCookie(request *http.Request) string {
+	value := cookieValue(request, sessionCookieName)
+	if value == "" {
+		return ""
+	}
+	return sessionCookieName + "=" + value
+}
+
+// validCSRFToken - Checks the submitted token against the csrf cookie. Requests that do not carry a session
+// are not cookie authenticated and need no token.
+func validCSRFToken(request *http.Request, submitted string) bool {
+	if sessionCookie(request) == "" {
+		return true
+	}
+	expected := cookieValue(request, csrfCookieName)
+	if expected == "" || submitted == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+}
+
+// hasSessionWithoutCSRFCookie - Sessions from before csrf tokens existed have the session cookie but no csrf cookie.
+func hasSessionWithoutCSRFCookie(request *http.Request) bool {
+	return sessionCookie(request) != "" && cookieValue(request, csrfCookieName) == ""
+}
+
+func isStateChanging(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// withCSRF - Rejects state changing http requests that carry a session but not a matching csrf token.
+func withCSRF(handler http.HandlerFunc) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		if isStateChanging(request.Method) && !validCSRFToken(request, request.Header.Get(csrfHeaderName)) {
+			log.Print("withCSRF(): Rejected request without a valid csrf token from ", clientIP(request), " on ", request.URL.Path)
+			writeJSONError(responseWriter, http.StatusForbidden, ErrorCodeInvalidCSRFToken, "invalid csrf token")
+			return
+		}
+		handler(responseWriter, request)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func csrfRequest(method string, origin string, session string, cookieToken string, headerToken string) *http.Request {
+	request := httptest.NewRequest(method, "/api/v1/http/chat/something", strings.NewReader("{}"))
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	if session != "" {
+		request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session})
+	}
+	if cookieToken != "" {
+		request.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookieToken})
+	}
+	if headerToken != "" {
+		request.Header.Set(csrfHeaderName, headerToken)
+	}
+	return request
+}
+
+func TestLoginIssuesCSRFToken(t *testing.T) {
+	defer setupLogin(t)()
+	recorder := doLogin(loginBody("dude", testPassword))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var csrfCookie *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == csrfCookieName {
+			csrfCookie = cookie
+		}
+	}
+	assert.NotNil(t, csrfCookie)
+	assert.False(t, csrfCookie.HttpOnly, "The client must be able to read the csrf cookie.")
+	assert.Contains(t, recorder.Body.String(), `"csrfToken":"`+csrfCookie.Value+`"`)
+}
+
+func TestCSRFProtection(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGIN", "joonas.ninja")
+	defer os.Unsetenv("ALLOWED_ORIGIN")
+	handler := withCORS(withCSRF(okHandler))
+	cases := []struct {
+		request  *http.Request
+		expected int
+		reason   string
+	}{
+		{csrfRequest("POST", "https://joonas.ninja", "token", "abc", "abc"), http.StatusOK, "matching token"},
+		{csrfRequest("POST", "https://joonas.ninja", "", "", ""), http.StatusOK, "no session, nothing to protect"},
+		{csrfRequest("GET", "https://joonas.ninja", "token", "abc", ""), http.StatusOK, "reads are not checked"},
+		{csrfRequest("POST", "https://joonas.ninja", "token", "abc", ""), http.StatusForbidden, "missing token"},
+		{csrfRequest("POST", "https://joonas.ninja", "token", "abc", "abd"), http.StatusForbidden, "wrong token"},
+		{csrfRequest("POST", "https://joonas.ninja", "token", "", "abc"), http.StatusForbidden, "no csrf cookie"},
+		{csrfRequest("POST", "https://evil.com", "token", "abc", "abc"), http.StatusForbidden, "forged origin"},
+		{csrfRequest("POST", "https://joonas.ninja.evil.com", "token", "abc", "abc"), http.StatusForbidden, "forged origin suffix"},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		handler(recorder, c.request)
+		assert.Equal(t, c.expected, recorder.Code, c.reason)
+	}
+}
+
+func TestWebsocketHandshakeRequiresCSRFToken(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGIN", "joonas.ninja")
+	defer os.Unsetenv("ALLOWED_ORIGIN")
+	server := httptest.NewServer(http.HandlerFunc(chatRequest))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{"Cookie": []string{"session=token; csrf=abc"}, "Origin": []string{"https://joonas.ninja"}}
+
+	_, response, err := websocket.DefaultDialer.Dial(url, header)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	_, response, err = websocket.DefaultDialer.Dial(url+"?csrf=wrong", header)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	header.Set("Origin", "https://evil.com")
+	_, response, err = websocket.DefaultDialer.Dial(url+"?csrf=abc", header)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	header.Set("Origin", "https://joonas.ninja")
+	ws, response, err := websocket.DefaultDialer.Dial(url+"?csrf=abc", header)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	ws.Close()
+}
+
+func TestSessionWithoutCSRFCookieIsNotLockedOut(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGIN", "joonas.ninja")
+	defer os.Unsetenv("ALLOWED_ORIGIN")
+	server := httptest.NewServer(http.HandlerFunc(chatRequest))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{"Cookie": []string{"session=token"}, "Origin": []string{"https://joonas.ninja"}}
+
+	ws, response, err := websocket.DefaultDialer.Dial(url, header)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	ws.Close()
+	var csrfCookie *http.Cookie
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == csrfCookieName {
+			csrfCookie = cookie
+		}
+	}
+	assert.NotNil(t, csrfCookie, "The handshake hands out the missing csrf cookie.")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxChannelEmoji - How many custom emoji one channel can have.
+const maxChannelEmoji = 100
+
+// shortcodePattern - A :name: shortcode in a message.
+var shortcodePattern = regexp.MustCompile(`:([a-z0-9_+-]{1,32}):`)
+
+// emojiNamePattern - What custom emoji names can look like.
+var emojiNamePattern = regexp.MustCompile(`^[a-z0-9_+-]{2,32}$`)
+
+// shortcodes - The built in shortcodes and their unicode emoji.
+var shortcodes = map[string]string{
+	"smile": "😄", "grin": "😁", "joy": "😂", "rofl": "🤣", "slight_smile": "🙂", "wink": "😉", "blush": "😊",
+	"heart_eyes": "😍", "kissing_heart": "😘", "thinking": "🤔", "neutral_face": "😐", "expressionless": "😑",
+	"unamused": "😒", "roll_eyes": "🙄", "grimacing": "😬", "relieved": "😌", "pensive": "😔", "sleepy": "😪",
+	"sleeping": "😴", "sunglasses": "😎", "confused": "😕", "worried": "😟", "open_mouth": "😮", "astonished": "😲",
+	"flushed": "😳", "cry": "😢", "sob": "😭", "scream": "😱", "angry": "😠", "rage": "😡", "skull": "💀",
+	"poop": "💩", "clown": "🤡", "ghost": "👻", "alien": "👽", "robot": "🤖", "wave": "👋", "ok_hand": "👌",
+	"thumbsup": "👍", "+1": "👍", "thumbsdown": "👎", "-1": "👎", "clap": "👏", "pray": "🙏", "muscle": "💪",
+	"eyes": "👀", "heart": "❤️", "broken_heart": "💔", "fire": "🔥", "star": "⭐", "sparkles": "✨", "zap": "⚡",
+	"tada": "🎉", "100": "💯", "check": "✅", "x": "❌", "warning": "⚠️", "question": "❓", "coffee": "☕",
+	"beer": "🍺", "pizza": "🍕", "cake": "🎂", "rocket": "🚀", "bug": "🐛", "cat": "🐱", "dog": "🐶",
+}
+
+// customEmoji - An emoji a channel admin has added to a channel. Messages refer to it with :name:. The image is always
+// an upload served by the chat, so that showing an emoji does not load anything from elsewhere.
+type customEmoji struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type channelEmojiDTO struct {
+	CreatorToken string        `json:"creatorToken"`
+	ChannelId    string        `json:"channelId"`
+	Emoji        []customEmoji `json:"emoji"`
+}
+
+// emojiStore - The custom emoji of the channels, loaded from the backend when a channel is first needed.
+type emojiStore struct {
+	mutex    sync.Mutex
+	channels map[string]map[string]string
+	updates  map[string]*sync.Mutex
+}
+
+var channelEmoji = &emojiStore{channels: map[string]map[string]string{}, updates: map[string]*sync.Mutex{}}
+
+// get - The custom emoji of the channel by name.
+func (s *emojiStore) get(channelId string) map[string]string {
+	s.mutex.Lock()
+	emoji, ok := s.channels[channelId]
+	s.mutex.Unlock()
+	if ok {
+		return emoji
+	}
+	emoji = map[string]string{}
+	res, err := apiRequest("GET", newApiRequestOptions(&apiRequestOptions{queryString: "?channelId=" + url.QueryEscape(channelId)}), "CHAT_CHANNEL_EMOJI_URL", nil)
+	if err != nil {
+		log.Print("emojiStore.get():", err)
+		return emoji
+	}
+	var list []customEmoji
+	if err := json.Unmarshal(res, &list); err != nil {
+		log.Print("emojiStore.get():", err)
+		return emoji
+	}
+	for _, custom := range list {
+		if strings.HasPrefix(custom.Url, attachmentsPath) {
+			emoji[custom.Name] = custom.Url
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[channelId] = emoji
+	return emoji
+}
+
+// updateLock - Keeps the updates of one channel in order. Other channels and readers do not wait for the backend.
+func (s *emojiStore) updateLock(channelId string) *sync.Mutex {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lock, ok := s.updates[channelId]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.updates[channelId] = lock
+	}
+	return lock
+}
+
+// update - Changes the custom emoji of the channel with the function and persists them. Nothing changes if either fails.
+func (s *emojiStore) update(user *User, channelId string, updateFn func(emoji map[string]string) error) error {
+	lock := s.updateLock(channelId)
+	lock.Lock()
+	defer lock.Unlock()
+	current := s.get(channelId)
+	emoji := map[string]string{}
+	for name, url := range current {
+		emoji[name] = url
+	}
+	if err := updateFn(emoji); err != nil {
+		return err
+	}
+	jsonResponse, err := json.Marshal(channelEmojiDTO{CreatorToken: user.Token, ChannelId: channelId, Emoji: sortedEmoji(emoji)})
+	if err != nil {
+		log.Print("emojiStore.update():", err)
+		return genericError()
+	}
+	if _, err := apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_CHANNEL_EMOJI_URL", nil); err != nil {
+		log.Print("emojiStore.update():", err)
+		return errors.New("error saving the channel emoji")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[channelId] = emoji
+	return nil
+}
+
+func sortedEmoji(emoji map[string]string) []customEmoji {
+	list := []customEmoji{}
+	for name, url := range emoji {
+		list = append(list, customEmoji{Name: name, Url: url})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// expandShortcodes - Replaces the built in shortcodes with unicode emoji. Custom emoji and unknown shortcodes are left as they are.
+func expandShortcodes(body string) string {
+	return shortcodePattern.ReplaceAllStringFunc(body, func(shortcode string) string {
+		if emoji, ok := shortcodes[shortcode[1:len(shortcode)-1]]; ok {
+			return emoji
+		}
+		return shortcode
+	})
+}
+
+// resolveCustomEmoji - The custom emoji of the channel the body refers to.
+func resolveCustomEmoji(body string, channelId string) []customEmoji {
+	matches := shortcodePattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	emoji := channelEmoji.get(channelId)
+	var found []customEmoji
+	seen := map[string]bool{}
+	for _, match := range matches {
+		if url, ok := emoji[match[1]]; ok && !seen[match[1]] {
+			seen[match[1]] = true
+			found = append(found, customEmoji{Name: match[1], Url: url})
+		}
+	}
+	return found
+}
+
+// renderCustomEmoji - Replaces the custom emoji shortcodes in html escaped text with images. The image html goes
+// through the wrap function so that the renderer can keep it apart from the text.
+func renderCustomEmoji(text string, emoji []customEmoji, wrapFn func(image string) string) string {
+	if len(emoji) == 0 {
+		return text
+	}
+	urls := map[string]string{}
+	for _, custom := range emoji {
+		urls[custom.Name] = custom.Url
+	}
+	return shortcodePattern.ReplaceAllStringFunc(text, func(shortcode string) string {
+		url, ok := urls[shortcode[1:len(shortcode)-1]]
+		if !ok {
+			return shortcode
+		}
+		return wrapFn(`<img class="emoji" alt="` + shortcode + `" title="` + shortcode + `" src="` + html.EscapeString(url) + `">`)
+	})
+}
+
+// applyEmoji - Expands the shortcodes of a chat message and attaches the custom emoji it uses. Code is left alone.
+func applyEmoji(message *EventData) {
+	if message.Format == FormatCode {
+		return
+	}
+	message.Body = expandShortcodes(message.Body)
+	message.Emoji = resolveCustomEmoji(message.Body, message.ChannelId)
+}
+
+// handleChannelEmoji - /channel emoji add <name> <attachment id>, /channel emoji remove <name> or /channel emoji list.
+// Only the channel admin can add and remove emoji. The image is uploaded to the channel first like any attachment.
+func handleChannelEmoji(params []string, user *User) error {
+	if len(params) == 3 && params[2] == "list" {
+		jsonResponse, err := json.Marshal(sortedEmoji(channelEmoji.get(user.CurrentChannelId)))
+		if err != nil {
+			log.Print("handleChannelEmoji():", err)
+			return genericError()
+		}
+		sendSystemMessage(string(jsonResponse), user, EventEmojiList)
+		return nil
+	}
+	if len(params) < 4 || (params[2] == "add" && len(params) != 5) || (params[2] == "remove" && len(params) != 4) {
+		return notEnoughParameters()
+	}
+	if params[2] != "add" && params[2] != "remove" {
+		return notEnoughParameters()
+	}
+	if !isChannelAdmin(user, user.CurrentChannelId) {
+		return replyMustBeChannelAdmin()
+	}
+	name := strings.Trim(strings.ToLower(params[3]), ":")
+	var err error
+	if params[2] == "add" {
+		if !emojiNamePattern.MatchString(name) {
+			return errors.New("emoji names can only have lower case letters, numbers, _, + and -, and be 2 to 32 long")
+		}
+		if _, ok := shortcodes[name]; ok {
+			return errors.New("that is a built in emoji")
+		}
+		files, resolveErr := resolveAttachments([]attachment{{Id: params[4]}}, user)
+		if resolveErr != nil || !strings.HasPrefix(files[0].ContentType, "image/") {
+			return errors.New("the emoji must be an image you have uploaded to this channel")
+		}
+		err = channelEmoji.update(user, user.CurrentChannelId, func(emoji map[string]string) error {
+			if _, ok := emoji[name]; !ok && len(emoji) >= maxChannelEmoji {
+				return errors.New("the channel can have at most " + strconv.Itoa(maxChannelEmoji) + " emoji")
+			}
+			emoji[name] = attachmentsPath + files[0].Id
+			return nil
+		})
+		if err == nil {
+			markAttachmentUsed(files[0])
+		}
+	} else {
+		err = channelEmoji.update(user, user.CurrentChannelId, func(emoji map[string]string) error {
+			if _, ok := emoji[name]; !ok {
+				return errors.New("no such emoji")
+			}
+			delete(emoji, name)
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	audit(AuditChannelEmoji, user.Name, name, user.CurrentChannelId, params[2])
+	if params[2] == "add" {
+		sendSystemMessage("Emoji :"+name+": added.", user, EventNotification)
+	} else {
+		sendSystemMessage("Emoji :"+name+": removed.", user, EventNotification)
+	}
+	return nil
+}
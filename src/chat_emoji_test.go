@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmojiShortcodes(t *testing.T) {
+	channelEmoji.channels["emojichannel"] = map[string]string{"partyparrot": "/api/v1/http/chat/attachments/abc"}
+	defer delete(channelEmoji.channels, "emojichannel")
+	message := EventData{Body: "nice :thumbsup: :partyparrot: :unknown: 10:30:45", ChannelId: "emojichannel", Format: FormatPlain}
+	applyEmoji(&message)
+	assert.Equal(t, "nice 👍 :partyparrot: :unknown: 10:30:45", message.Body)
+	assert.Equal(t, []customEmoji{{Name: "partyparrot", Url: "/api/v1/http/chat/attachments/abc"}}, message.Emoji)
+	assert.Equal(t, `<p>nice 👍 <img class="emoji" alt=":partyparrot:" title=":partyparrot:" src="/api/v1/http/chat/attachments/abc"> :unknown: 10:30:45</p>`,
+		renderMessage(message.Body, message.Format, message.Emoji))
+
+	probe := EventData{Body: "[x](https://a.example/:partyparrot:) `:partyparrot:` :partyparrot:", ChannelId: "emojichannel", Format: FormatMarkdown}
+	applyEmoji(&probe)
+	assert.Equal(t, `<p><a href="https://a.example/:partyparrot:" rel="nofollow noopener noreferrer" target="_blank">x</a> <code>:partyparrot:</code> `+
+		`<img class="emoji" alt=":partyparrot:" title=":partyparrot:" src="/api/v1/http/chat/attachments/abc"></p>`,
+		renderMessage(probe.Body, probe.Format, probe.Emoji))
+
+	code := EventData{Body: ":smile:", Format: FormatCode}
+	applyEmoji(&code)
+	assert.Equal(t, ":smile:", code.Body)
+}
+
+func TestSlowEmojiSaveDoesNotBlockOtherChannels(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	os.Setenv("CHAT_CHANNEL_EMOJI_URL", backend.URL)
+	channelEmoji.channels["slowsave"] = map[string]string{}
+	channelEmoji.channels["otherchannel"] = map[string]string{"wave": "/api/v1/http/chat/attachments/wave"}
+	defer func() {
+		backend.Close()
+		os.Unsetenv("CHAT_CHANNEL_EMOJI_URL")
+		delete(channelEmoji.channels, "slowsave")
+		delete(channelEmoji.channels, "otherchannel")
+	}()
+	saved := make(chan error)
+	go func() {
+		saved <- channelEmoji.update(&User{Token: "token"}, "slowsave", func(emoji map[string]string) error {
+			emoji["new"] = "/api/v1/http/chat/attachments/new"
+			return nil
+		})
+	}()
+	read := make(chan map[string]string)
+	go func() { read <- channelEmoji.get("otherchannel") }()
+	select {
+	case emoji := <-read:
+		assert.Equal(t, "/api/v1/http/chat/attachments/wave", emoji["wave"])
+	case <-time.After(time.Second):
+		t.Error("Reading the emoji of another channel should not wait for the save.")
+	}
+	close(release)
+	assert.Nil(t, <-saved)
+	assert.Equal(t, "/api/v1/http/chat/attachments/new", channelEmoji.get("slowsave")["new"])
+}
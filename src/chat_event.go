@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type chatLogin struct {
@@ -26,29 +28,113 @@ type tokenValidationRes struct {
 	DefaultChannel string `json:"defaultChannel"`
 }
 
+// prepareMessage - Runs the checks every chat message goes through before it is sent. Returns the body to send in
+// the given format, or false if the message should be dropped. The user has been told why. Only messages with
+// attachments can have an empty body.
+func prepareMessage(body string, format string, hasAttachments bool, user *User) (string, bool) {
+	if user.isGuest() && loadGuestPolicy().readOnly {
+		sendSystemMessage("Guests can only read the chat. Log in to send messages.", user, EventErrorNotification)
+		return "", false
+	}
+	if !allowMessage(user) {
+		return "", false
+	}
+	body, ok := runMessageProcessors(body, format, user)
+	if !ok {
+		return "", false
+	}
+	body, err := formatBody(body, format)
+	if err != nil && !(err == errEmptyMessage && hasAttachments) {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return "", false
+	}
+	return body, true
+}
+
 // handleMessageEvent -
-func handleMessageEvent(body string, user *User) {
+func handleMessageEvent(event EventData, user *User) {
+	body := event.Body
 	if strings.Index(body, "/") != 0 {
 		value, _ := Users.Load(user)
 		user := value.(*User)
-		sendToAllOnChannel(body, user, EventMessage, true, true)
+		sendUserMessage(event, messageLimit(user), user)
+	} else if params := strings.Split(strings.TrimPrefix(body, "/"), " "); params[0] == CommandMe {
+		// Actions are messages too, so they need the format of the event.
+		if err := handleMeCommand(params, event.Format, user); err != nil {
+			sendSystemMessage(err.Error(), user, EventErrorNotification)
+		}
 	} else {
 		handleCommand(body, user)
 	}
 }
 
+// sendUserMessage - Sends the body of the event as a chat message of the user to their channel, with the format
+// and the attachments of the event.
+func sendUserMessage(event EventData, maxBytes int, user *User) {
+	body := event.Body
+	if !checkMessageSize(body, maxBytes, user) {
+		return
+	}
+	format, err := normalizeFormat(event.Format)
+	if err != nil {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return
+	}
+	attachments, err := resolveAttachments(event.Attachments, user)
+	if err != nil {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return
+	}
+	body, ok := prepareMessage(body, format, len(attachments) > 0, user)
+	if !ok {
+		return
+	}
+	for _, file := range attachments {
+		markAttachmentUsed(file)
+	}
+	sendChatMessage(user, EventData{Id: newMessageId(), Event: EventMessage, ChannelId: user.CurrentChannelId, Body: body,
+		Name: user.Name, UserCount: UserCount, CreatedDate: time.Now(), Format: format, Attachments: attachments})
+}
+
+// handleMeCommand - /me <action> sends an action message in the given format, like "* nick waves".
+func handleMeCommand(params []string, format string, user *User) error {
+	if len(params) < 2 {
+		return notEnoughParameters()
+	}
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return err
+	}
+	if format == FormatCode {
+		return errors.New("actions can not be code")
+	}
+	body := strings.Join(params[1:], " ")
+	if !checkMessageSize(body, messageLimit(user), user) {
+		return nil
+	}
+	body, ok := prepareMessage(body, format, false, user)
+	if !ok {
+		return nil
+	}
+	sendChatMessage(user, EventData{Id: newMessageId(), Event: EventAction, ChannelId: user.CurrentChannelId, Body: body,
+		Name: user.Name, UserCount: UserCount, CreatedDate: time.Now(), Format: format})
+	return nil
+}
+
 // handleJoin -
 func handleJoin(chatUser *User) {
 	chatHistory := getChatHistory(chatUser.CurrentChannelId)
 	if !reflect.DeepEqual(chatHistory, ChatHistory{}) {
+		chatHistory.Pins = channelPins.get(chatUser.CurrentChannelId)
 		marshalAndWriteToStream(chatUser, chatHistory)
 	} else {
 		sendSystemMessage("Error refreshing chat history.", chatUser, EventErrorNotification)
 	}
 	sendSystemMessage(chatUser.Name, chatUser, EventJoin)
+	deliverInbox(chatUser)
 	sendToOtherOnChannel(chatUser.Name+" has joined the channel.", chatUser, EventNotification, false, false)
 }
 
 // HandleTypingEvent -
-func handleTypingEvent(body string, user *User) {
+func handleTypingEvent(event EventData, user *User) {
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSlowModeSeconds - The longest slow mode a channel admin can set.
+const maxSlowModeSeconds = 3600
+
+// floodState - Per connection bookkeeping for flood control. Only touched from the reader of the connection.
+type floodState struct {
+	strikes     int
+	firstStrike time.Time
+	mutedUntil  time.Time
+	mutes       int
+}
+
+// floodPolicy - Message rate limits. See env/README.md.
+type floodPolicy struct {
+	messagesPerMinute        int
+	messageBurst             int
+	channelMessagesPerMinute int
+	channelMessageBurst      int
+	strikesBeforeMute        int
+	strikeWindow             time.Duration
+	muteDuration             time.Duration
+	mutesBeforeDisconnect    int
+}
+
+func loadFloodPolicy() floodPolicy {
+	return floodPolicy{
+		messagesPerMinute:        getEnvInt("MESSAGES_PER_MINUTE", 30),
+		messageBurst:             getEnvInt("MESSAGE_BURST", 10),
+		channelMessagesPerMinute: getEnvInt("CHANNEL_MESSAGES_PER_MINUTE", 600),
+		channelMessageBurst:      getEnvInt("CHANNEL_MESSAGE_BURST", 100),
+		strikesBeforeMute:        getEnvInt("FLOOD_STRIKES_BEFORE_MUTE", 5),
+		strikeWindow:             time.Duration(getEnvInt("FLOOD_STRIKE_WINDOW_SECONDS", 60)) * time.Second,
+		muteDuration:             time.Duration(getEnvInt("FLOOD_MUTE_SECONDS", 60)) * time.Second,
+		mutesBeforeDisconnect:    getEnvInt("FLOOD_MUTES_BEFORE_DISCONNECT", 3),
+	}
+}
+
+func (p floodPolicy) newMessageBucket() *tokenBucket {
+	return newTokenBucket(float64(p.messageBurst), float64(p.messagesPerMinute)/60)
+}
+
+// channelBuckets - Rate limits for each channel, keyed by channel id.
+var channelBuckets sync.Map
+
+// channelSlowModes - The slow mode of each channel that has one, keyed by channel id.
+var channelSlowModes sync.Map
+
+// slowMode - The slow mode delay of a channel and when each user last sent a message on it, keyed by slowModeKey.
+// Kept with the channel so that leaving and coming back does not start the wait over.
+type slowMode struct {
+	mutex        sync.Mutex
+	delay        time.Duration
+	lastMessages map[string]time.Time
+}
+
+// slowModeKey - Who a message counts against. Guests by their address since a reconnect gives them a new name.
+func slowModeKey(user *User) string {
+	if user.isGuest() {
+		return "ip:" + user.IP
+	}
+	return "account:" + strings.ToLower(user.accountName())
+}
+
+// waiting - Whether the user still has to wait before their next message.
+func (s *slowMode) waiting(key string, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return now.Sub(s.lastMessages[key]) < s.delay
+}
+
+// record - Starts the wait of the user. Waits that are over are dropped.
+func (s *slowMode) record(key string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for other, last := range s.lastMessages {
+		if now.Sub(last) >= s.delay {
+			delete(s.lastMessages, other)
+		}
+	}
+	s.lastMessages[key] = now
+}
+
+func channelBucket(channelId string, policy floodPolicy) *tokenBucket {
+	bucket, _ := channelBuckets.LoadOrStore(channelId, newTokenBucket(float64(policy.channelMessageBurst), float64(policy.channelMessagesPerMinute)/60))
+	return bucket.(*tokenBucket)
+}
+
+func setSlowMode(channelId string, delay time.Duration) {
+	if delay <= 0 {
+		channelSlowModes.Delete(channelId)
+		return
+	}
+	value, _ := channelSlowModes.LoadOrStore(channelId, &slowMode{lastMessages: map[string]time.Time{}})
+	mode := value.(*slowMode)
+	mode.mutex.Lock()
+	defer mode.mutex.Unlock()
+	mode.delay = delay
+}
+
+func getSlowMode(channelId string) *slowMode {
+	value, ok := channelSlowModes.Load(channelId)
+	if !ok {
+		return nil
+	}
+	return value.(*slowMode)
+}
+
+// pruneChannel - Drops the flood control state of a channel once nobody is on it. The slow mode itself stays.
+func pruneChannel(channelId string) {
+	empty := true
+	Users.Range(func(key, value interface{}) bool {
+		if value.(*User).CurrentChannelId == channelId {
+			empty = false
+		}
+		return empty
+	})
+	if empty {
+		channelBuckets.Delete(channelId)
+		if mode := getSlowMode(channelId); mode != nil {
+			mode.mutex.Lock()
+			mode.lastMessages = map[string]time.Time{}
+			mode.mutex.Unlock()
+		}
+	}
+}
+
+// allowMessage - Runs the flood checks for a message the user is about to send. Warns the user when the
+// message is not allowed and mutes or disconnects users that keep on flooding.
+func allowMessage(user *User) bool {
+	policy := loadFloodPolicy()
+	now := time.Now()
+	if now.Before(user.flood.mutedUntil) {
+		sendSystemMessage("You are muted for flooding. Try again in "+strconv.Itoa(int(user.flood.mutedUntil.Sub(now).Seconds())+1)+" seconds.", user, EventErrorNotification)
+		return false
+	}
+	if !takeMessageToken(user, policy, now) {
+		return false
+	}
+	slowMode := getSlowMode(user.CurrentChannelId)
+	if slowMode != nil && isAdmin(user) {
+		slowMode = nil
+	}
+	if slowMode != nil && slowMode.waiting(slowModeKey(user), now) {
+		addFloodStrike(user, policy, now, "Slow mode is on. You can send one message every "+strconv.Itoa(int(slowMode.delay.Seconds()))+" seconds.")
+		return false
+	}
+	if !channelBucket(user.CurrentChannelId, policy).take() {
+		sendSystemMessage("This channel is too busy right now. Try again in a moment.", user, EventErrorNotification)
+		return false
+	}
+	if slowMode != nil {
+		slowMode.record(slowModeKey(user), now)
+	}
+	return true
+}
+
+// takeMessageToken - Takes one message from the rate limit of the user. Warns the user when there is none left.
+func takeMessageToken(user *User, policy floodPolicy, now time.Time) bool {
+	if user.messageBucket != nil && !user.messageBucket.take() {
+		addFloodStrike(user, policy, now, "You are sending messages too fast. Slow down.")
+		return false
+	}
+	return true
+}
+
+func addFloodStrike(user *User, policy floodPolicy, now time.Time, warning string) {
+	if now.Sub(user.flood.firstStrike) > policy.strikeWindow {
+		user.flood.strikes = 0
+		user.flood.firstStrike = now
+	}
+	user.flood.strikes++
+	if user.flood.strikes < policy.strikesBeforeMute {
+		sendSystemMessage(warning, user, EventErrorNotification)
+		return
+	}
+	user.flood.strikes = 0
+	user.flood.mutes++
+	if user.flood.mutes >= policy.mutesBeforeDisconnect {
+		audit(AuditDisconnect, AuditSystemActor, user.Name, user.CurrentChannelId, "flooding")
+		sendSystemMessage("You have been disconnected for flooding.", user, EventErrorNotification)
+		user.Connection.Close()
+		return
+	}
+	user.flood.mutedUntil = now.Add(policy.muteDuration)
+	audit(AuditMute, AuditSystemActor, user.Name, user.CurrentChannelId, "flooding")
+	sendSystemMessage("You have been muted for "+strconv.Itoa(int(policy.muteDuration.Seconds()))+" seconds for flooding.", user, EventErrorNotification)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The formats of a chat message. Plain is the default.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+	FormatCode     = "code"
+)
+
+const codeFence = "```"
+
+// htmlTagPattern - Anything that looks like an html tag or comment. Markdown messages can not contain html.
+var htmlTagPattern = regexp.MustCompile(`<!--[\s\S]*?-->|</?[a-zA-Z][^>]*>`)
+
+var errEmptyMessage = errors.New("no empty messages")
+
+// markdownLinkPattern - Markdown links and images.
+var markdownLinkPattern = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]*)[^)]*\)`)
+
+// markdownLinkDefinitionPattern - Reference-style link definitions, like "[1]: https://example.com".
+var markdownLinkDefinitionPattern = regexp.MustCompile(`(?m)^ {0,3}\[([^\]]+)\]:[ \t]*(\S*).*$`)
+
+// safeLinkSchemes - The schemes links in markdown messages can have.
+var safeLinkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// normalizeFormat - The format of the message with the default filled in, or an error for formats that do not exist.
+func normalizeFormat(format string) (string, error) {
+	switch format {
+	case "", FormatPlain:
+		return FormatPlain, nil
+	case FormatMarkdown, FormatCode:
+		return format, nil
+	}
+	return "", errors.New("unknown message format")
+}
+
+func isSafeLink(link string) bool {
+	parsed, err := url.Parse(link)
+	return err == nil && safeLinkSchemes[strings.ToLower(parsed.Scheme)]
+}
+
+// sanitizeMarkdown - Removes html, turns links with unsafe schemes into their text, drops link definitions with
+// unsafe schemes and closes an unclosed code block, so that clients can render the message as markdown safely.
+// Removing something can put together a new tag or link, like "<<b>script>", so it is repeated until nothing changes.
+func sanitizeMarkdown(body string) string {
+	for {
+		sanitized := htmlTagPattern.ReplaceAllString(body, "")
+		sanitized = markdownLinkPattern.ReplaceAllStringFunc(sanitized, func(link string) string {
+			parts := markdownLinkPattern.FindStringSubmatch(link)
+			if isSafeLink(parts[3]) {
+				return parts[1] + "[" + parts[2] + "](" + parts[3] + ")"
+			}
+			return parts[2]
+		})
+		sanitized = markdownLinkDefinitionPattern.ReplaceAllStringFunc(sanitized, func(definition string) string {
+			if isSafeLink(markdownLinkDefinitionPattern.FindStringSubmatch(definition)[2]) {
+				return definition
+			}
+			return ""
+		})
+		if sanitized == body {
+			break
+		}
+		body = sanitized
+	}
+	if strings.Count(body, codeFence)%2 == 1 {
+		body += "\n" + codeFence
+	}
+	return body
+}
+
+// formatBody - Validates the body for its format. Markdown is sanitized. A body that is empty after that is an error.
+func formatBody(body string, format string) (string, error) {
+	switch format {
+	case FormatMarkdown:
+		body = sanitizeMarkdown(body)
+	case FormatCode:
+		if strings.Contains(body, codeFence) {
+			return "", errors.New("code messages can not contain code fences")
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return body, errEmptyMessage
+	}
+	return body, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeMarkdown(t *testing.T) {
+	assert.Equal(t, "**bold** alert(1)", sanitizeMarkdown("**bold** <script>alert(1)</script>"))
+	assert.Equal(t, "[site](https://example.com) and click", sanitizeMarkdown("[site](https://example.com) and [click](javascript:evil)"))
+	assert.Equal(t, "a < b", sanitizeMarkdown("a < b"))
+	assert.Equal(t, "```\ncode\n```", sanitizeMarkdown("```\ncode"))
+	assert.Equal(t, "alert(1)", sanitizeMarkdown("<<b>script>alert(1)<</b>/script>"))
+	assert.Equal(t, "", sanitizeMarkdown("<[x](javascript:a)script>"))
+	assert.Equal(t, "[click][1]\n\n", sanitizeMarkdown("[click][1]\n\n[1]: javascript:alert(1)"))
+	assert.Equal(t, "[site][1]\n\n[1]: https://example.com", sanitizeMarkdown("[site][1]\n\n[1]: https://example.com"))
+	_, err := normalizeFormat("html")
+	assert.NotNil(t, err)
+	_, err = formatBody("```nested```", FormatCode)
+	assert.NotNil(t, err)
+	_, err = formatBody("<b></b>", FormatMarkdown)
+	assert.Equal(t, errEmptyMessage, err, "Markdown that sanitizes to nothing is empty.")
+}
+
+func TestActionAndFormattedMessages(t *testing.T) {
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	name := readUntil(t, ws, EventJoin).Body
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "/me waves"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	action := readUntil(t, ws, EventAction)
+	assert.Equal(t, "waves", action.Body)
+	assert.Equal(t, name, action.Name)
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "*hi* <b>there</b>", Format: FormatMarkdown})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, ws, EventMessage)
+	assert.Equal(t, "*hi* there", message.Body)
+	assert.Equal(t, FormatMarkdown, message.Format)
+	assert.Equal(t, "<p><em>hi</em> there</p>", message.Html)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var guestAdjectives = []string{
+	"Brave", "Calm", "Clever", "Cosmic", "Curious", "Eager", "Fuzzy", "Gentle", "Happy", "Jolly",
+	"Lucky", "Mellow", "Nimble", "Quiet", "Rapid", "Shiny", "Silent", "Sleepy", "Swift", "Witty",
+}
+
+var guestAnimals = []string{
+	"Badger", "Beaver", "Falcon", "Ferret", "Fox", "Gecko", "Heron", "Koala", "Lynx", "Moose",
+	"Otter", "Owl", "Panda", "Puffin", "Raven", "Seal", "Sloth", "Tiger", "Walrus", "Yak",
+}
+
+// Names that no guest should ever get no matter what the prefix is set to.
+var defaultReservedNames = []string{"admin", "administrator", "moderator", "mod", "system", "server", "root"}
+
+// guestPolicy - What users without a login are allowed to do. See env/README.md.
+type guestPolicy struct {
+	enabled           bool
+	readOnly          bool
+	publicOnly        bool
+	messagesPerMinute int
+	messageBurst      int
+	namePrefix        string
+	reservedNames     []string
+}
+
+func loadGuestPolicy() guestPolicy {
+	namePrefix, found := os.LookupEnv("GUEST_NAME_PREFIX")
+	if !found {
+		namePrefix = "Anon"
+	}
+	reservedNames := append([]string{}, defaultReservedNames...)
+	for _, name := range strings.Split(os.Getenv("RESERVED_NAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			reservedNames = append(reservedNames, name)
+		}
+	}
+	return guestPolicy{
+		enabled:           os.Getenv("GUESTS_ENABLED") != "false",
+		readOnly:          os.Getenv("GUESTS_READ_ONLY") == "true",
+		publicOnly:        os.Getenv("GUESTS_PUBLIC_ONLY") != "false",
+		messagesPerMinute: getEnvInt("GUEST_MESSAGES_PER_MINUTE", 0),
+		messageBurst:      getEnvInt("GUEST_MESSAGE_BURST", 5),
+		namePrefix:        namePrefix,
+		reservedNames:     reservedNames,
+	}
+}
+
+func (p guestPolicy) isReservedName(name string) bool {
+	for _, reserved := range p.reservedNames {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return name == SystemName
+}
+
+// newMessageBucket - The rate limit for a new guest. Falls back to the limit everyone has when guests are not limited separately.
+func (p guestPolicy) newMessageBucket() *tokenBucket {
+	if p.messagesPerMinute <= 0 {
+		return loadFloodPolicy().newMessageBucket()
+	}
+	return newTokenBucket(float64(p.messageBurst), float64(p.messagesPerMinute)/60)
+}
+
+// isNameInUse - Whether a connected user already has the name. Case insensitive.
+func isNameInUse(name string) bool {
+	return findUserByName(name) != nil
+}
+
+// newGuestName - A random readable name like AnonSwiftOtter that no connected user has.
+// When all the combinations are tried unsuccessfully a number is added to the end.
+func (p guestPolicy) newGuestName() string {
+	var name string
+	for i := 0; i < 20; i++ {
+		name = p.namePrefix + guestAdjectives[rand.Intn(len(guestAdjectives))] + guestAnimals[rand.Intn(len(guestAnimals))]
+		if !p.isReservedName(name) && !isNameInUse(name) {
+			return name
+		}
+	}
+	for {
+		numbered := name + strconv.Itoa(rand.Intn(10000))
+		if !p.isReservedName(numbered) && !isNameInUse(numbered) {
+			return numbered
+		}
+	}
+}
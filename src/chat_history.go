@@ -6,11 +6,12 @@ import (
 )
 
 type ChatHistory struct {
-	Body      []EventData `json:"history"`
-	UserCount int32       `json:"userCount"`
-	Event     string      `json:"event"`
+	Body      []EventData     `json:"history"`
+	UserCount int32           `json:"userCount"`
+	Event     string          `json:"event"`
+	Pins      []pinnedMessage `json:"pins"`
 }
- 
+
 // updateChatHistory - Adds the parameter defined chat history entry to chat history
 func updateChatHistory(jsonResponse []byte) {
 	go apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_HISTORY_URL", nil)
@@ -27,5 +28,25 @@ func getChatHistory(channelId string) ChatHistory {
 		log.Print("getChatHistory():", err)
 		return ChatHistory{}
 	}
+	for i, message := range eventData {
+		sentMessages.addIfMissing(message)
+		if cached, ok := sentMessages.get(message.Id); ok {
+			eventData[i] = cached
+		}
+	}
 	return ChatHistory{Event: EventChatHistory, Body: eventData, UserCount: UserCount}
 }
+
+// findChannelMessage - A message of the channel by id. Messages that have dropped out of the cache are looked up
+// from the history of the channel.
+func findChannelMessage(channelId string, id string) (EventData, bool) {
+	if message, ok := sentMessages.get(id); ok {
+		return message, message.ChannelId == channelId
+	}
+	for _, message := range getChatHistory(channelId).Body {
+		if message.Id == id {
+			return message, true
+		}
+	}
+	return EventData{}, false
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+)
+
+// maxIgnored - How many users one user can ignore.
+const maxIgnored = 100
+
+type ignoreListDTO struct {
+	CreatorToken string   `json:"creatorToken"`
+	Ignored      []string `json:"ignored"`
+}
+
+// isIgnoring - Whether the user has the other user on their ignore list. Logged in users are ignored by account
+// and guests by connection, so a new nick does not get anyone off the list.
+func (u *User) isIgnoring(other *User) bool {
+	if u == other {
+		return false
+	}
+	u.ignoreMutex.RLock()
+	defer u.ignoreMutex.RUnlock()
+	if other.isGuest() {
+		return u.ignoredGuests[other]
+	}
+	return u.ignored[strings.ToLower(other.accountName())]
+}
+
+// isIgnoringName - Whether the author of a stored message is ignored. The author is looked up from the connected
+// users so that a guest or a renamed user is matched too.
+func (u *User) isIgnoringName(name string) bool {
+	if other := findUserByName(name); other != nil && u.isIgnoring(other) {
+		return true
+	}
+	u.ignoreMutex.RLock()
+	defer u.ignoreMutex.RUnlock()
+	return u.ignored[strings.ToLower(name)]
+}
+
+// ignoredNames - The ignored accounts and the current names of the ignored guests.
+func (u *User) ignoredNames() []string {
+	u.ignoreMutex.RLock()
+	defer u.ignoreMutex.RUnlock()
+	names := []string{}
+	for name := range u.ignored {
+		names = append(names, name)
+	}
+	for guest := range u.ignoredGuests {
+		names = append(names, guest.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ignoredAccounts - The part of the ignore list that is persisted. Guests are gone once they disconnect.
+func (u *User) ignoredAccounts() []string {
+	u.ignoreMutex.RLock()
+	defer u.ignoreMutex.RUnlock()
+	names := []string{}
+	for name := range u.ignored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ignoreTarget - Who a nick given to /ignore or /unignore means. A connected user is resolved to their account,
+// or to their connection when they are a guest. Anything else is taken to be an account name.
+func ignoreTarget(name string) (string, *User) {
+	other := findUserByName(name)
+	if other == nil {
+		return strings.ToLower(name), nil
+	}
+	if other.isGuest() {
+		return "", other
+	}
+	return strings.ToLower(other.accountName()), nil
+}
+
+func (u *User) setIgnored(names []string) {
+	u.ignoreMutex.Lock()
+	defer u.ignoreMutex.Unlock()
+	u.ignored = map[string]bool{}
+	for _, name := range names {
+		u.ignored[strings.ToLower(name)] = true
+	}
+}
+
+// loadIgnoreList - Fetches the persisted ignore list of a logged in user. Guests start with an empty list.
+func loadIgnoreList(user *User) {
+	if user.isGuest() {
+		return
+	}
+	jsonResponse, _ := json.Marshal(ignoreListDTO{CreatorToken: user.Token})
+	res, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_IGNORE_LIST_URL", nil)
+	if err != nil {
+		log.Print("loadIgnoreList():", err)
+		return
+	}
+	var ignored []string
+	if err := json.Unmarshal(res, &ignored); err != nil {
+		log.Print("loadIgnoreList():", err)
+		return
+	}
+	user.setIgnored(ignored)
+}
+
+// saveIgnoreList - Persists the ignore list of a logged in user. Guest lists only live as long as the connection.
+func saveIgnoreList(user *User) error {
+	if user.isGuest() {
+		return nil
+	}
+	jsonResponse, _ := json.Marshal(ignoreListDTO{CreatorToken: user.Token, Ignored: user.ignoredAccounts()})
+	_, err := apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_IGNORE_LIST_URL", nil)
+	return err
+}
+
+func replyIgnoreListNotSaved(user *User) {
+	sendSystemMessage("The ignore list could not be saved. The change only lasts until you disconnect.", user, EventErrorNotification)
+}
+
+// handleIgnoreCommand - /ignore <nick> or /ignore list
+func handleIgnoreCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	if params[1] == "list" {
+		jsonResponse, err := json.Marshal(user.ignoredNames())
+		if err != nil {
+			log.Print("handleIgnoreCommand():", err)
+			return genericError()
+		}
+		sendSystemMessage(string(jsonResponse), user, EventIgnoreList)
+		return nil
+	}
+	if len(params[1]) > 64 {
+		return errors.New("that name is too long")
+	}
+	account, guest := ignoreTarget(params[1])
+	if guest == user || (!user.isGuest() && account == strings.ToLower(user.accountName())) {
+		return errors.New("you can not ignore yourself")
+	}
+	user.ignoreMutex.Lock()
+	if user.ignored == nil {
+		user.ignored = map[string]bool{}
+	}
+	if user.ignoredGuests == nil {
+		user.ignoredGuests = map[*User]bool{}
+	}
+	if user.ignored[account] || user.ignoredGuests[guest] {
+		user.ignoreMutex.Unlock()
+		return errors.New("you are already ignoring " + params[1])
+	}
+	if len(user.ignored)+len(user.ignoredGuests) >= maxIgnored {
+		user.ignoreMutex.Unlock()
+		return errors.New("your ignore list is full")
+	}
+	if guest != nil {
+		user.ignoredGuests[guest] = true
+	} else {
+		user.ignored[account] = true
+	}
+	user.ignoreMutex.Unlock()
+	if err := saveIgnoreList(user); err != nil {
+		log.Print("handleIgnoreCommand():", err)
+		replyIgnoreListNotSaved(user)
+	}
+	sendSystemMessage("You are now ignoring "+params[1]+".", user, EventNotification)
+	return nil
+}
+
+// handleUnignoreCommand - /unignore <nick>
+func handleUnignoreCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	account, guest := ignoreTarget(params[1])
+	user.ignoreMutex.Lock()
+	if !user.ignored[account] && !user.ignoredGuests[guest] {
+		user.ignoreMutex.Unlock()
+		return errors.New("you are not ignoring " + params[1])
+	}
+	delete(user.ignored, account)
+	delete(user.ignoredGuests, guest)
+	user.ignoreMutex.Unlock()
+	if err := saveIgnoreList(user); err != nil {
+		log.Print("handleUnignoreCommand():", err)
+		replyIgnoreListNotSaved(user)
+	}
+	sendSystemMessage("You are no longer ignoring "+params[1]+".", user, EventNotification)
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The kinds of things that wait in the inbox of a user who was offline.
+// Invites are added by the backend when it stores the invite, the others by the chat.
+const (
+	InboxMention       = "mention"
+	InboxDirectMessage = "directMessage"
+	InboxInvite        = "invite"
+)
+
+// inboxItem - A mention, direct message or invite that a user got while offline.
+type inboxItem struct {
+	Id      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Message EventData `json:"message"`
+	Read    bool      `json:"read"`
+}
+
+// newInboxItemDTO - An item sent to the backend for the named user. The backend drops names that are not registered.
+type newInboxItemDTO struct {
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"`
+	Message EventData `json:"message"`
+}
+
+type inboxRequestDTO struct {
+	CreatorToken string   `json:"creatorToken"`
+	Ids          []string `json:"ids,omitempty"`
+	All          bool     `json:"all,omitempty"`
+}
+
+// inboxDTO - The body of the inbox event.
+type inboxDTO struct {
+	Unread int         `json:"unread"`
+	Items  []inboxItem `json:"items"`
+}
+
+// queueInboxItem - Stores the message in the inbox of the named user.
+func queueInboxItem(name string, kind string, message EventData) {
+	jsonResponse, err := json.Marshal(newInboxItemDTO{Name: name, Kind: kind, Message: message})
+	if err != nil {
+		log.Print("queueInboxItem():", err)
+		return
+	}
+	go apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_INBOX_URL", nil)
+}
+
+// getInbox - The unread inbox items of a logged in user, or all of the recent ones. Items from ignored users are left out.
+func getInbox(user *User, all bool) (inboxDTO, error) {
+	inbox := inboxDTO{Items: []inboxItem{}}
+	jsonResponse, _ := json.Marshal(inboxRequestDTO{CreatorToken: user.Token, All: all})
+	res, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_INBOX_LIST_URL", nil)
+	if err != nil {
+		return inbox, err
+	}
+	var items []inboxItem
+	if err := json.Unmarshal(res, &items); err != nil {
+		return inbox, err
+	}
+	for _, item := range items {
+		if item.Message.Name != "" && user.isIgnoringName(item.Message.Name) {
+			continue
+		}
+		if !item.Read {
+			inbox.Unread++
+		}
+		inbox.Items = append(inbox.Items, item)
+	}
+	return inbox, nil
+}
+
+// markInboxRead - Marks the given items as read. No ids marks the whole inbox as read.
+func markInboxRead(user *User, ids []string) error {
+	jsonResponse, _ := json.Marshal(inboxRequestDTO{CreatorToken: user.Token, Ids: ids, All: len(ids) == 0})
+	_, err := apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_INBOX_URL", nil)
+	return err
+}
+
+// deliverInbox - Sends the summary of what the user got while offline. Only done once per connection and only
+// when there is something unread.
+func deliverInbox(user *User) {
+	if user.isGuest() {
+		return
+	}
+	user.inboxOnce.Do(func() {
+		inbox, err := getInbox(user, false)
+		if err != nil {
+			log.Print("deliverInbox():", err)
+			return
+		}
+		if inbox.Unread == 0 {
+			return
+		}
+		jsonResponse, err := json.Marshal(inbox)
+		if err != nil {
+			log.Print("deliverInbox():", err)
+			return
+		}
+		sendSystemMessage(string(jsonResponse), user, EventInbox)
+	})
+}
+
+// handleInboxCommand - /inbox lists the unread items, /inbox all the recent ones and /inbox read [id...] marks
+// items, or all of them, as read.
+func handleInboxCommand(params []string, user *User) error {
+	if user.isGuest() {
+		return replyMustBeLoggedIn()
+	}
+	if len(params) >= 2 && params[1] == "read" {
+		if err := markInboxRead(user, params[2:]); err != nil {
+			log.Print("handleInboxCommand():", err)
+			return errors.New("error updating the inbox")
+		}
+		sendSystemMessage("Marked as read.", user, EventNotification)
+		return nil
+	}
+	if len(params) > 2 || (len(params) == 2 && params[1] != "all") {
+		return notEnoughParameters()
+	}
+	inbox, err := getInbox(user, len(params) == 2)
+	if err != nil {
+		log.Print("handleInboxCommand():", err)
+		return errors.New("error reading the inbox")
+	}
+	jsonResponse, err := json.Marshal(inbox)
+	if err != nil {
+		log.Print("handleInboxCommand():", err)
+		return genericError()
+	}
+	sendSystemMessage(string(jsonResponse), user, EventInbox)
+	return nil
+}
+
+// handleDirectMessageCommand - /msg <nick> <message> sends a message only the named user sees. Users that are
+// not online get it in their inbox.
+func handleDirectMessageCommand(params []string, user *User) error {
+	if len(params) < 3 {
+		return notEnoughParameters()
+	}
+	name := params[1]
+	if strings.EqualFold(name, user.Name) {
+		return errors.New("you can not message yourself")
+	}
+	body := strings.Join(params[2:], " ")
+	if !checkMessageSize(body, messageLimit(user), user) {
+		return nil
+	}
+	body, ok := prepareMessage(body, FormatPlain, false, user)
+	if !ok {
+		return nil
+	}
+	message := EventData{Id: newMessageId(), Event: EventDirectMessage, Body: body, Name: user.Name, To: name,
+		UserCount: UserCount, CreatedDate: time.Now(), Format: FormatPlain, Html: renderMessage(body, FormatPlain, nil)}
+	jsonResponse, err := json.Marshal(message)
+	if err != nil {
+		log.Print("handleDirectMessageCommand():", err)
+		return genericError()
+	}
+	var online bool
+	Users.Range(func(key, value interface{}) bool {
+		target := value.(*User)
+		if target == user || !strings.EqualFold(target.Name, name) {
+			return true
+		}
+		online = true
+		if canDeliver(user, target, true) {
+			if err := target.write(websocket.TextMessage, jsonResponse); err != nil {
+				log.Print("handleDirectMessageCommand():", err)
+			}
+		}
+		return true
+	})
+	if !online && !user.isShadowBanned() {
+		queueInboxItem(name, InboxDirectMessage, message)
+	}
+	marshalAndWriteToStream(user, message)
+	if !online {
+		sendSystemMessage(name+" is not online. They will see the message when they connect, if they are registered.", user, EventNotification)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboxSkipsIgnoredUsers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":"1","kind":"mention","message":{"name":"friend","body":"hi @me"}},
+			{"id":"2","kind":"directMessage","message":{"name":"troll","body":"hey"}},
+			{"id":"3","kind":"invite","message":{"name":"friend","body":"secret"},"read":true}]`)
+	}))
+	os.Setenv("CHAT_INBOX_LIST_URL", server.URL)
+	defer func() {
+		server.Close()
+		os.Unsetenv("CHAT_INBOX_LIST_URL")
+	}()
+	user := &User{Name: "me", Token: "token"}
+	user.setIgnored([]string{"Troll"})
+	inbox, err := getInbox(user, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, inbox.Unread)
+	assert.Len(t, inbox.Items, 2)
+	assert.Equal(t, InboxInvite, inbox.Items[1].Kind)
+}
+
+func TestDirectMessageOnlyReachesTheRecipient(t *testing.T) {
+	sender, server := testSetup(t)
+	recipient, otherServer := testSetup(t)
+	defer func() {
+		sender.Close()
+		recipient.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	readUntil(t, sender, EventJoin)
+	recipientName := readUntil(t, recipient, EventJoin).Body
+
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "/msg " + recipientName + " see https://example.com"})
+	assert.Nil(t, sender.WriteMessage(websocket.TextMessage, jsonResponse))
+	echo := readUntil(t, sender, EventDirectMessage)
+	assert.Equal(t, recipientName, echo.To)
+	message := readUntil(t, recipient, EventDirectMessage)
+	assert.Equal(t, "see https://example.com", message.Body)
+	assert.Empty(t, message.ChannelId)
+}
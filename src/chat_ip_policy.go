@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipBans - Addresses and ranges banned at runtime by the admins. Persisted through the backend.
+var ipBans = newBanList("CHAT_IP_BAN_URL")
+
+// staticIPBans - Addresses and ranges from DENIED_IPS. Can only be changed by editing the env.
+var staticIPBans = newBanList("")
+
+// trustedProxies - The proxies from TRUSTED_PROXIES whose X-Forwarded-For header is believed.
+var trustedProxies = newBanList("")
+
+var connectionMutex sync.Mutex
+
+// connectionsPerIP - How many websocket connections each address has open right now.
+var connectionsPerIP = map[string]int{}
+
+// connectionRateLimiter - Locks out addresses that open too many connections in a short time.
+var connectionRateLimiter = newAttemptLimiter(30, time.Minute, time.Minute)
+
+// initIPPolicy - Reads the address lists and the connection rate limits from the env and loads the runtime bans. See env/README.md.
+func initIPPolicy() {
+	staticIPBans = ipListFromEnv("DENIED_IPS")
+	trustedProxies = ipListFromEnv("TRUSTED_PROXIES")
+	if os.Getenv("IS_PROD") == "true" && len(trustedProxies.list().IPs) == 0 {
+		log.Print("initIPPolicy():", "TRUSTED_PROXIES is not set. Behind a reverse proxy every client has the address of the proxy.")
+	}
+	connectionRateLimiter = newAttemptLimiter(getEnvInt("CONNECTIONS_PER_MINUTE", 30), time.Minute,
+		time.Duration(getEnvInt("CONNECTION_LOCKOUT_SECONDS", 60))*time.Second)
+	ipBans.load()
+	log.Print("initIPPolicy():", "Address lists loaded.")
+}
+
+func ipListFromEnv(env string) *banList {
+	list := newBanList("")
+	for _, value := range strings.Split(os.Getenv(env), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			if err := list.addIP(value); err != nil {
+				log.Print("ipListFromEnv(): ", env, ": ", err)
+			}
+		}
+	}
+	return list
+}
+
+// remoteIP - The address of the peer that made the request.
+func remoteIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// clientIP - The address of the client. When the request comes through a trusted proxy the X-Forwarded-For
+// header is walked from the right and the first address that is not a trusted proxy is the client.
+func clientIP(request *http.Request) string {
+	ip := remoteIP(request)
+	if !trustedProxies.hasIP(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxies.hasIP(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func isDeniedIP(ip string) bool {
+	return staticIPBans.hasIP(ip) || ipBans.hasIP(ip)
+}
+
+// acquireConnection - Checks the address against the deny lists and the connection limits and counts the
+// connection in if it is allowed. Every successful acquire must be paired with a releaseConnection.
+func acquireConnection(ip string) (int, error) {
+	if isDeniedIP(ip) {
+		return http.StatusForbidden, errors.New("address is banned")
+	}
+	if _, locked := connectionRateLimiter.locked(ip); locked {
+		return http.StatusTooManyRequests, errors.New("too many connections in a short time")
+	}
+	connectionRateLimiter.add(ip)
+	connectionMutex.Lock()
+	defer connectionMutex.Unlock()
+	if connectionsPerIP[ip] >= getEnvInt("MAX_CONNECTIONS_PER_IP", 10) {
+		return http.StatusTooManyRequests, errors.New("too many open connections")
+	}
+	connectionsPerIP[ip]++
+	return http.StatusOK, nil
+}
+
+func releaseConnection(ip string) {
+	connectionMutex.Lock()
+	defer connectionMutex.Unlock()
+	connectionsPerIP[ip]--
+	if connectionsPerIP[ip] <= 0 {
+		delete(connectionsPerIP, ip)
+	}
+}
+
+// disconnectIP - Closes every connection from the address or range.
+func disconnectIP(value string, reason string) {
+	list := newBanList("")
+	if err := list.addIP(value); err != nil {
+		return
+	}
+	Users.Range(func(key, value interface{}) bool {
+		user := value.(*User)
+		if list.hasIP(user.IP) {
+			sendSystemMessage(reason, user, EventErrorNotification)
+			user.Connection.Close()
+		}
+		return true
+	})
+}
+
+func saveIPBans(admin *User) {
+	if err := ipBans.save(); err != nil {
+		log.Print("saveIPBans():", err)
+		sendSystemMessage("The ban list could not be saved. The change is lost when the server restarts.", admin, EventErrorNotification)
+	}
+}
+
+// handleBanCommand - /ban <nick> bans the address the user is connected from, /ban ip <address or range>
+// bans an address and /ban list shows the banned addresses. Everyone connected from a banned address is disconnected.
+func handleBanCommand(params []string, user *User) error {
+	if !isAdmin(user) {
+		return errors.New("only admins can do that")
+	}
+	var address, target string
+	if len(params) == 2 && params[1] == "list" {
+		jsonResponse, err := json.Marshal(ipBans.list().IPs)
+		if err != nil {
+			log.Print("handleBanCommand():", err)
+			return genericError()
+		}
+		sendSystemMessage(string(jsonResponse), user, EventBanList)
+		return nil
+	} else if len(params) == 3 && params[1] == "ip" {
+		address = params[2]
+		target = params[2]
+	} else if len(params) == 2 {
+		targetUser := findUserByName(params[1])
+		if targetUser == nil {
+			return errors.New("no such user online")
+		}
+		address = targetUser.IP
+		target = targetUser.Name
+	} else {
+		return notEnoughParameters()
+	}
+	banned := newBanList("")
+	if err := banned.addIP(address); err != nil {
+		return err
+	}
+	if banned.hasIP(user.IP) {
+		return errors.New("you can not ban your own address")
+	}
+	if err := ipBans.addIP(address); err != nil {
+		return err
+	}
+	audit(AuditBan, user.Name, target, "", "ip "+address)
+	saveIPBans(user)
+	disconnectIP(address, "You have been banned.")
+	sendSystemMessage(target+" is now banned.", user, EventNotification)
+	return nil
+}
+
+// handleUnbanCommand - /unban ip <address or range>
+func handleUnbanCommand(params []string, user *User) error {
+	if !isAdmin(user) {
+		return errors.New("only admins can do that")
+	}
+	if len(params) != 3 || params[1] != "ip" {
+		return notEnoughParameters()
+	}
+	if !ipBans.removeIP(params[2]) {
+		return errors.New("that address is not banned")
+	}
+	audit(AuditUnban, user.Name, params[2], "", "ip")
+	saveIPBans(user)
+	sendSystemMessage(params[2]+" is no longer banned.", user, EventNotification)
+	return nil
+}
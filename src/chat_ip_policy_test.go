@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	defer func() {
+		os.Unsetenv("TRUSTED_PROXIES")
+		trustedProxies = newBanList("")
+	}()
+	trustedProxies = ipListFromEnv("TRUSTED_PROXIES")
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "203.0.113.5:1234"
+	request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	assert.Equal(t, "203.0.113.5", clientIP(request), "Only trusted proxies may forward addresses.")
+
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "1.2.3.4, 198.51.100.7, 10.0.0.2")
+	assert.Equal(t, "198.51.100.7", clientIP(request), "The first untrusted hop from the right is the client.")
+
+	request.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", clientIP(request))
+}
+
+func TestConnectionLimits(t *testing.T) {
+	os.Setenv("MAX_CONNECTIONS_PER_IP", "2")
+	defer os.Unsetenv("MAX_CONNECTIONS_PER_IP")
+	ip := "198.51.100.1"
+	_, err := acquireConnection(ip)
+	assert.Nil(t, err)
+	_, err = acquireConnection(ip)
+	assert.Nil(t, err)
+	status, err := acquireConnection(ip)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	releaseConnection(ip)
+	_, err = acquireConnection(ip)
+	assert.Nil(t, err)
+	releaseConnection(ip)
+	releaseConnection(ip)
+	assert.NotContains(t, connectionsPerIP, ip)
+
+	assert.Nil(t, ipBans.addIP("198.51.100.0/24"))
+	defer ipBans.removeIP("198.51.100.0/24")
+	status, err = acquireConnection(ip)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestAdminCanNotBanOwnAddress(t *testing.T) {
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer os.Unsetenv("CHAT_ADMINS")
+	admin := &User{Name: "boss", Token: "token", IP: "203.0.113.9"}
+	assert.NotNil(t, handleBanCommand([]string{CommandBan, "ip", "203.0.113.9"}, admin))
+	assert.NotNil(t, handleBanCommand([]string{CommandBan, "ip", "203.0.113.0/24"}, admin), "A range with the own address in it is refused too.")
+	assert.False(t, ipBans.hasIP("203.0.113.9"))
+}
+
+func TestDeniedAddressCannotConnect(t *testing.T) {
+	staticIPBans = newBanList("")
+	staticIPBans.addIP("127.0.0.1")
+	defer func() {
+		staticIPBans = newBanList("")
+	}()
+	server := httptest.NewServer(http.HandlerFunc(chatRequest))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
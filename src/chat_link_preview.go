@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxPreviewsPerMessage - How many links of one message get a preview.
+const maxPreviewsPerMessage = 2
+
+// maxPreviewBytes - How much of a page is read looking for its metadata.
+const maxPreviewBytes = 512 * 1024
+
+// maxPreviewCacheSize - How many previews are kept in memory.
+const maxPreviewCacheSize = 1000
+
+// maxPreviewTextLength - Longer titles and descriptions are cut.
+const maxPreviewTextLength = 300
+
+const previewTimeout = 3 * time.Second
+const previewCacheDuration = time.Hour
+const failedPreviewCacheDuration = 5 * time.Minute
+
+// previewLinkPattern - The links that get previews. Only full http and https urls.
+var previewLinkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'\x60]+`)
+
+var (
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?s)([a-zA-Z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// allowPrivatePreviewTargets - Previews are never fetched from loopback or private addresses so that messages can not
+// be used to probe the network the chat runs in. Tests turn this off to use a local server.
+var allowPrivatePreviewTargets = false
+
+// linkPreview - What a linked page is about.
+type linkPreview struct {
+	Url         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+// linkPreviewDTO - The body of the preview event.
+type linkPreviewDTO struct {
+	MessageId string      `json:"messageId"`
+	Preview   linkPreview `json:"preview"`
+}
+
+type cachedPreview struct {
+	preview   linkPreview
+	ok        bool
+	expiresAt time.Time
+}
+
+var previewMutex sync.Mutex
+
+// previewCache - Fetched previews by url. Failures are cached too, for a shorter time.
+var previewCache = map[string]cachedPreview{}
+
+// previewFetch - A fetch that is in progress. Done is closed once the result is set.
+type previewFetch struct {
+	done   chan struct{}
+	result cachedPreview
+}
+
+// previewsInFlight - The fetches in progress by url, so that a link posted many times at once is fetched only once.
+var previewsInFlight = map[string]*previewFetch{}
+
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// previewClient - Checks every address it connects to, including the ones redirects lead to.
+var previewClient = &http.Client{
+	Timeout: previewTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: previewTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || (isPrivateAddress(ip) && !allowPrivatePreviewTargets) {
+					return errors.New("preview target not allowed: " + host)
+				}
+				return nil
+			},
+		}).DialContext,
+		Proxy:                 nil,
+		ResponseHeaderTimeout: previewTimeout,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+			return errors.New("redirect to an unsupported scheme")
+		}
+		return nil
+	},
+}
+
+// previewLinks - The distinct links of the body that get a preview.
+func previewLinks(body string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, link := range previewLinkPattern.FindAllString(body, -1) {
+		link = strings.TrimRight(link, ".,!?:;)")
+		if seen[link] {
+			continue
+		}
+		if len(links) == maxPreviewsPerMessage {
+			break
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
+
+func cutText(text string) string {
+	text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+	if runes := []rune(text); len(runes) > maxPreviewTextLength {
+		return string(runes[:maxPreviewTextLength-1]) + "…"
+	}
+	return text
+}
+
+// parsePreview - Reads the title, description, image and site name of the page, preferring the OpenGraph tags.
+func parsePreview(page string, pageUrl *url.URL) linkPreview {
+	preview := linkPreview{Url: pageUrl.String()}
+	meta := map[string]string{}
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attributes := map[string]string{}
+		for _, attribute := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attributes[strings.ToLower(attribute[1])] = attribute[2] + attribute[3] + attribute[4]
+		}
+		key := strings.ToLower(attributes["property"])
+		if key == "" {
+			key = strings.ToLower(attributes["name"])
+		}
+		if _, found := meta[key]; key != "" && !found {
+			meta[key] = attributes["content"]
+		}
+	}
+	preview.Title = cutText(meta["og:title"])
+	if preview.Title == "" {
+		if title := titlePattern.FindStringSubmatch(page); title != nil {
+			preview.Title = cutText(title[1])
+		}
+	}
+	preview.Description = cutText(meta["og:description"])
+	if preview.Description == "" {
+		preview.Description = cutText(meta["description"])
+	}
+	preview.SiteName = cutText(meta["og:site_name"])
+	if image, err := pageUrl.Parse(html.UnescapeString(strings.TrimSpace(meta["og:image"]))); err == nil && meta["og:image"] != "" {
+		if image.Scheme == "http" || image.Scheme == "https" {
+			preview.Image = image.String()
+		}
+	}
+	return preview
+}
+
+// fetchPreview - Fetches the page behind the link and reads its metadata. Only html pages have previews.
+func fetchPreview(link string) (linkPreview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return linkPreview{}, err
+	}
+	request.Header.Set("Accept", "text/html")
+	request.Header.Set("User-Agent", "joonas.ninja-chat link preview")
+	response, err := previewClient.Do(request)
+	if err != nil {
+		return linkPreview{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return linkPreview{}, errors.New("preview target answered " + response.Status)
+	}
+	if mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type")); err != nil || mediaType != "text/html" {
+		return linkPreview{}, errors.New("preview target is not html")
+	}
+	page, err := io.ReadAll(io.LimitReader(response.Body, maxPreviewBytes))
+	if err != nil {
+		return linkPreview{}, err
+	}
+	preview := parsePreview(string(page), response.Request.URL)
+	preview.Url = link
+	if preview.Title == "" && preview.Description == "" && preview.Image == "" {
+		return linkPreview{}, errors.New("nothing to preview")
+	}
+	return preview, nil
+}
+
+// getPreview - The preview of the link from the cache, fetching it if it is not there. Callers asking for a link
+// that is already being fetched wait for that fetch.
+func getPreview(link string) (linkPreview, bool) {
+	now := time.Now()
+	previewMutex.Lock()
+	cached, found := previewCache[link]
+	if found && now.Before(cached.expiresAt) {
+		previewMutex.Unlock()
+		return cached.preview, cached.ok
+	}
+	if fetch, ok := previewsInFlight[link]; ok {
+		previewMutex.Unlock()
+		<-fetch.done
+		return fetch.result.preview, fetch.result.ok
+	}
+	fetch := &previewFetch{done: make(chan struct{})}
+	previewsInFlight[link] = fetch
+	previewMutex.Unlock()
+
+	preview, err := fetchPreview(link)
+	cached = cachedPreview{preview: preview, ok: err == nil, expiresAt: now.Add(previewCacheDuration)}
+	if err != nil {
+		log.Print("getPreview(): ", link, ": ", err)
+		cached.expiresAt = now.Add(failedPreviewCacheDuration)
+	}
+	previewMutex.Lock()
+	defer previewMutex.Unlock()
+	fetch.result = cached
+	delete(previewsInFlight, link)
+	close(fetch.done)
+	if len(previewCache) >= maxPreviewCacheSize {
+		for key, old := range previewCache {
+			if now.After(old.expiresAt) || len(previewCache) >= maxPreviewCacheSize {
+				delete(previewCache, key)
+			}
+		}
+	}
+	previewCache[link] = cached
+	return cached.preview, cached.ok
+}
+
+// sendLinkPreviews - Fetches the previews of the links in a message and sends each to the channel of the message
+// as soon as it is ready. The previews are also added to the cached message for the ones who join later.
+// Runs in its own goroutine. Previews are content of the author so that they are filtered like the message.
+func sendLinkPreviews(user *User, message EventData) {
+	if message.Format == FormatCode {
+		return
+	}
+	for _, link := range previewLinks(message.Body) {
+		preview, ok := getPreview(link)
+		if !ok {
+			continue
+		}
+		if !user.isShadowBanned() {
+			sentMessages.update(message.Id, func(cached *EventData) error {
+				cached.Previews = append(append([]linkPreview{}, cached.Previews...), preview)
+				return nil
+			})
+		}
+		jsonResponse, err := json.Marshal(linkPreviewDTO{MessageId: message.Id, Preview: preview})
+		if err != nil {
+			log.Print("sendLinkPreviews():", err)
+			continue
+		}
+		sendEventData(user, EventData{Event: EventLinkPreview, ChannelId: message.ChannelId, Body: string(jsonResponse), Name: user.Name,
+			UserCount: UserCount, CreatedDate: time.Now()}, false, sendToChannelFilter(message.ChannelId))
+	}
+}
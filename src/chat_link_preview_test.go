@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func previewTargetTest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, `<html><head><title>Fallback</title>
+		<meta property="og:title" content="A &amp; B">
+		<meta content="What the page is about" name="description">
+		<meta property='og:image' content='/cover.png'>
+		</head><body></body></html>`)
+}
+
+func TestPreviewLinks(t *testing.T) {
+	assert.Equal(t, []string{"https://a.example/x", "http://b.example"}, previewLinks("see https://a.example/x, http://b.example and https://c.example"))
+}
+
+func TestPrivatePreviewTargetsAreBlocked(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(previewTargetTest))
+	defer target.Close()
+	_, err := fetchPreview(target.URL)
+	assert.NotNil(t, err)
+}
+
+func TestLinkPreviewIsSentForMessage(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(previewTargetTest))
+	allowPrivatePreviewTargets = true
+	ws, server := testSetup(t)
+	defer func() {
+		allowPrivatePreviewTargets = false
+		target.Close()
+		server.Close()
+		ws.Close()
+	}()
+	readUntil(t, ws, EventJoin)
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "look at " + target.URL + "/page"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, ws, EventMessage)
+
+	var preview linkPreviewDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, ws, EventLinkPreview).Body), &preview))
+	assert.Equal(t, message.Id, preview.MessageId)
+	assert.Equal(t, linkPreview{Url: target.URL + "/page", Title: "A & B", Description: "What the page is about", Image: target.URL + "/cover.png"}, preview.Preview)
+	cached, _ := sentMessages.get(message.Id)
+	assert.Equal(t, []linkPreview{preview.Preview}, cached.Previews)
+}
+
+func TestConcurrentPreviewsAreFetchedOnce(t *testing.T) {
+	var fetches atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		previewTargetTest(w, r)
+	}))
+	allowPrivatePreviewTargets = true
+	defer func() {
+		allowPrivatePreviewTargets = false
+		target.Close()
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			preview, ok := getPreview(target.URL + "/once")
+			assert.True(t, ok)
+			assert.Equal(t, "A & B", preview.Title)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestShadowBannedLinkPreviewOnlyReachesTheAuthor(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(previewTargetTest))
+	allowPrivatePreviewTargets = true
+	poster, server := testSetup(t)
+	reader, otherServer := testSetup(t)
+	defer func() {
+		allowPrivatePreviewTargets = false
+		target.Close()
+		poster.Close()
+		reader.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	posterName := readUntil(t, poster, EventJoin).Body
+	readUntil(t, reader, EventJoin)
+	findUserByName(posterName).shadowBanned.Store(true)
+
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "look at " + target.URL + "/banned"})
+	assert.Nil(t, poster.WriteMessage(websocket.TextMessage, jsonResponse))
+	readUntil(t, poster, EventLinkPreview)
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "after the preview"})
+	assert.Nil(t, reader.WriteMessage(websocket.TextMessage, jsonResponse))
+	for {
+		var responseData EventData
+		_, message, err := reader.ReadMessage()
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Nil(t, json.Unmarshal(message, &responseData))
+		assert.NotEqual(t, EventLinkPreview, responseData.Event, "The preview of a shadow banned user should not reach others.")
+		if responseData.Event == EventMessage && responseData.Body == "after the preview" {
+			return
+		}
+	}
+}
@@ -7,51 +7,149 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// maxRequestBodySize - Http request bodies larger than this are rejected before parsing.
+const maxRequestBodySize = 1024
+
+type loginResponse struct {
+	Username       string `json:"username"`
+	DefaultChannel string `json:"defaultChannel"`
+	CSRFToken      string `json:"csrfToken"`
+}
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var errLoginParametersTooShort = errors.New("parameters too short")
+
+// errInvalidCredentials - The gateway rejected the login. Only these count as failed attempts, not gateway outages.
+var errInvalidCredentials = errors.New("invalid username or password")
+
+var loginIPLimiter = newAttemptLimiter(20, 15*time.Minute, 15*time.Minute)
+var loginAccountLimiter = newAttemptLimiter(5, 15*time.Minute, 15*time.Minute)
+
+// initLoginLimiters - Sets up the login rate limits from the env.
+func initLoginLimiters() {
+	window := time.Duration(getEnvInt("LOGIN_FAILURE_WINDOW_SECONDS", 900)) * time.Second
+	lockout := time.Duration(getEnvInt("LOGIN_LOCKOUT_SECONDS", 900)) * time.Second
+	loginIPLimiter = newAttemptLimiter(getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20), window, lockout)
+	loginAccountLimiter = newAttemptLimiter(getEnvInt("LOGIN_MAX_FAILURES_PER_ACCOUNT", 5), window, lockout)
+}
+
 func SessionRequest(responseWriter http.ResponseWriter, request *http.Request) {
 
 }
 
-func loginRequest(responseWriter http.ResponseWriter, request *http.Request) {
-	var loginRes loginDTO
+func writeJSON(responseWriter http.ResponseWriter, status int, response any) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		log.Print("writeJSON():", err)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(status)
+	responseWriter.Write(jsonResponse)
+}
 
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		allowedOrigin, found := os.LookupEnv("ALLOWED_ORIGIN")
-		if found {
-			return r.Header.Get("Origin") == "http://"+allowedOrigin ||
-				r.Header.Get("Origin") == "https://"+allowedOrigin ||
-				r.Header.Get("Origin") == "https://www."+allowedOrigin ||
-				r.Header.Get("Origin") == "http://www."+allowedOrigin
-		}
-		return true
+func writeJSONError(responseWriter http.ResponseWriter, status int, code string, message string) {
+	writeJSON(responseWriter, status, errorResponse{Code: code, Message: message})
+}
+
+func writeTooManyAttempts(responseWriter http.ResponseWriter, retryAfter time.Duration) {
+	responseWriter.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	writeJSONError(responseWriter, http.StatusTooManyRequests, ErrorCodeTooManyAttempts, "too many failed login attempts. Try again later")
+}
+
+// cookieAttributes - The attributes shared by all the cookies set by the chat.
+func cookieAttributes() string {
+	isSecure, found := os.LookupEnv("IS_PROD")
+	if found && isSecure == "true" {
+		isSecure = " secure;"
+	} else {
+		isSecure = ""
 	}
+	domain, found := os.LookupEnv("DOMAIN")
+	if !found {
+		domain = ""
+	}
+	var exp = time.Now()
+	exp = exp.AddDate(1, 0, 0)
+	s := exp.Format(http.TimeFormat)
+	return "; expires=" + s + "; sameSite=Strict; path=/;" + isSecure + "domain=" + domain + ";"
+}
+
+func loginRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	var loginRes loginDTO
 	if request.Method == "POST" {
-		body, err := ioutil.ReadAll(request.Body)
-		err = json.Unmarshal(body, &loginRes)
+		ipKey := clientIP(request)
+		if retryAfter, locked := loginIPLimiter.locked(ipKey); locked {
+			log.Print("loginRequest(): Too many failed attempts from ", ipKey)
+			writeTooManyAttempts(responseWriter, retryAfter)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(responseWriter, request.Body, maxRequestBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Print("loginRequest():", err)
+			writeJSONError(responseWriter, http.StatusRequestEntityTooLarge, ErrorCodeBadRequest, "request body too large")
+			return
+		}
 		if err != nil {
-			log.Print("getChatHistory():", err)
+			log.Print("loginRequest():", err)
+			writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "malformed login request")
+			return
+		}
+		if err := json.Unmarshal(body, &loginRes); err != nil {
+			log.Print("loginRequest():", err)
+			writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "malformed login request")
+			return
+		}
+		accountKey := strings.ToLower(loginRes.Username)
+		if retryAfter, locked := loginAccountLimiter.locked(accountKey); locked {
+			log.Print("loginRequest(): Account locked: ", accountKey)
+			writeTooManyAttempts(responseWriter, retryAfter)
+			return
 		}
 		token, err := HandleloginRequest(loginRes.Username, loginRes.Password)
+		if errors.Is(err, errLoginParametersTooShort) {
+			writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, errInvalidCredentials) {
+			loginIPLimiter.add(ipKey)
+			if loginAccountLimiter.add(accountKey) {
+				log.Print("loginRequest(): Locking account after too many failed attempts: ", accountKey)
+			}
+			writeJSONError(responseWriter, http.StatusUnauthorized, ErrorCodeUnauthorized, errInvalidCredentials.Error())
+			return
+		}
 		if err != nil {
-			http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+			log.Print("loginRequest():", err)
+			writeJSONError(responseWriter, http.StatusBadGateway, ErrorCodeLoginFailed, "login is not available right now. Try again later")
 			return
 		}
-		isSecure, found := os.LookupEnv("IS_PROD")
-		if found && isSecure == "true" {
-			isSecure = " secure;"
-		} else {
-			isSecure = ""
+		loginAccountLimiter.reset(accountKey)
+		validationRes, err := validateToken(token)
+		if err != nil {
+			writeJSONError(responseWriter, http.StatusBadGateway, ErrorCodeLoginFailed, "error fetching user information")
+			return
 		}
-		domain, found := os.LookupEnv("DOMAIN")
-		if !found {
-			domain = ""
+		csrfToken, err := newCSRFToken()
+		if err != nil {
+			log.Print("loginRequest():", err)
+			writeJSONError(responseWriter, http.StatusInternalServerError, ErrorCodeLoginFailed, "error creating session")
+			return
 		}
-		var exp = time.Now()
-		exp = exp.AddDate(1, 0, 0)
-		s := exp.Format(http.TimeFormat)
-		responseWriter.Header().Add("Set-Cookie", "session="+token+"; expires="+s+"; httpOnly; sameSite=Strict; path=/;"+isSecure+"domain="+domain+";")
+		responseWriter.Header().Add("Set-Cookie", sessionCookieName+"="+token+"; httpOnly"+cookieAttributes())
+		responseWriter.Header().Add("Set-Cookie", csrfCookieName+"="+csrfToken+cookieAttributes())
+		writeJSON(responseWriter, http.StatusOK, loginResponse{Username: validationRes.Username, DefaultChannel: validationRes.DefaultChannel, CSRFToken: csrfToken})
 	} else {
 		http.NotFound(responseWriter, request)
 	}
@@ -65,11 +163,13 @@ func HandleloginRequest(email string, password string) (loginToken string, err e
 		loginRes, loginError := apiLoginRequest(email, password)
 		if loginError != nil {
 			return "", loginError
+		} else if loginRes.Token == "" {
+			return "", errors.New("login response did not contain a token")
 		} else {
 			responseToken = loginRes.Token
 		}
-		log.Print("HandleLoginEvent():", "Login successful")
+		log.Print("HandleloginRequest():", "Login successful")
 		return responseToken, nil
 	}
-	return "", errors.New("parameters too short")
+	return "", errLoginParametersTooShort
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPassword = "hunter22"
+
+// A stand-in for the gateway. Accepts testPassword for every account.
+func loginGatewayTest(w http.ResponseWriter, r *http.Request) {
+	var login chatLogin
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &login)
+	if login.Password != testPassword {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprint(w, `{"token":"token-`+login.Email+`"}`)
+}
+
+func tokenGatewayTest(w http.ResponseWriter, r *http.Request) {
+	var token gatewayDTO
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &token)
+	fmt.Fprint(w, `{"username":"`+strings.TrimPrefix(strings.TrimPrefix(token.Token, sessionCookieName+"="), "token-")+`","defaultChannel":"general"}`)
+}
+
+func setupLogin(t *testing.T) func() {
+	loginServer := httptest.NewServer(http.HandlerFunc(loginGatewayTest))
+	tokenServer := httptest.NewServer(http.HandlerFunc(tokenGatewayTest))
+	os.Setenv("CHAT_LOGIN_URL", loginServer.URL)
+	os.Setenv("CHAT_TOKEN_URL", tokenServer.URL)
+	loginIPLimiter = newAttemptLimiter(20, time.Minute, time.Minute)
+	loginAccountLimiter = newAttemptLimiter(3, time.Minute, time.Minute)
+	return func() {
+		loginServer.Close()
+		tokenServer.Close()
+		os.Unsetenv("CHAT_LOGIN_URL")
+		os.Unsetenv("CHAT_TOKEN_URL")
+	}
+}
+
+func doLogin(body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/api/v1/http/chat/login", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	loginRequest(recorder, request)
+	return recorder
+}
+
+func loginBody(username string, password string) string {
+	body, _ := json.Marshal(loginDTO{Username: username, Password: password})
+	return string(body)
+}
+
+func TestLoginSuccess(t *testing.T) {
+	defer setupLogin(t)()
+	recorder := doLogin(loginBody("dude", testPassword))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Set-Cookie"), "session=token-dude;")
+	var response loginResponse
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "dude", response.Username)
+	assert.Equal(t, "general", response.DefaultChannel)
+}
+
+func TestLoginErrorCodes(t *testing.T) {
+	defer setupLogin(t)()
+	var response errorResponse
+
+	recorder := doLogin("{not json")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeBadRequest, response.Code)
+
+	recorder = doLogin(loginBody("dude", "x"))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = doLogin(loginBody("dude", strings.Repeat("x", maxRequestBodySize)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	recorder = doLogin(loginBody("dude", "wrongpassword"))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeUnauthorized, response.Code)
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	defer setupLogin(t)()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, doLogin(loginBody("victim", "wrongpassword")).Code)
+	}
+	recorder := doLogin(loginBody("victim", testPassword))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	var response errorResponse
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, ErrorCodeTooManyAttempts, response.Code)
+	assert.Equal(t, http.StatusOK, doLogin(loginBody("someoneelse", testPassword)).Code,
+		"A locked account should not affect other accounts.")
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	defer setupLogin(t)()
+	loginIPLimiter = newAttemptLimiter(2, time.Minute, time.Minute)
+	assert.Equal(t, http.StatusUnauthorized, doLogin(loginBody("first", "wrongpassword")).Code)
+	assert.Equal(t, http.StatusUnauthorized, doLogin(loginBody("second", "wrongpassword")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doLogin(loginBody("third", testPassword)).Code)
+}
+
+func TestLoginGatewayFailureDoesNotLockOut(t *testing.T) {
+	defer setupLogin(t)()
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	os.Setenv("CHAT_LOGIN_URL", gateway.URL)
+	for i := 0; i < 5; i++ {
+		recorder := doLogin(loginBody("victim", testPassword))
+		assert.Equal(t, http.StatusBadGateway, recorder.Code)
+		var response errorResponse
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, ErrorCodeLoginFailed, response.Code)
+	}
+	gateway.Close()
+	os.Setenv("CHAT_LOGIN_URL", "http://127.0.0.1:1")
+	assert.Equal(t, http.StatusBadGateway, doLogin(loginBody("victim", testPassword)).Code)
+
+	_, locked := loginAccountLimiter.locked("victim")
+	assert.False(t, locked, "An unavailable gateway should not lock the account.")
+	_, locked = loginIPLimiter.locked("192.0.2.1")
+	assert.False(t, locked)
+}
+
+func TestAttemptLimiterLockoutExpires(t *testing.T) {
+	now := time.Now()
+	limiter := newAttemptLimiter(2, time.Minute, time.Minute)
+	limiter.timeNow = func() time.Time { return now }
+	assert.False(t, limiter.add("key"))
+	assert.True(t, limiter.add("key"))
+	_, locked := limiter.locked("key")
+	assert.True(t, locked)
+	now = now.Add(2 * time.Minute)
+	_, locked = limiter.locked("key")
+	assert.False(t, locked)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The inline markdown the server renders. Applied to html escaped text.
+var (
+	inlineCodePattern         = regexp.MustCompile("`([^`]+)`")
+	markdownInlineLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern               = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern             = regexp.MustCompile(`\*([^*]+)\*`)
+	underscorePattern         = regexp.MustCompile(`(^|[^\w])_([^_]+)_([^\w]|$)`)
+	placeholder               = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// renderMessage - A sanitized html rendering of the body for clients to show as is. Markdown messages support bold,
+// italics, inline code, code blocks, links and quotes. Everything else is escaped. The custom emoji of the message
+// are shown as images in the text, but not in code or links.
+func renderMessage(body string, format string, emoji []customEmoji) string {
+	switch format {
+	case FormatMarkdown:
+		return renderMarkdown(body, emoji)
+	case FormatCode:
+		return "<pre><code>" + html.EscapeString(body) + "</code></pre>"
+	}
+	return "<p>" + strings.ReplaceAll(renderCustomEmoji(html.EscapeString(body), emoji, func(image string) string { return image }), "\n", "<br>") + "</p>"
+}
+
+// renderMarkdown - Renders the block level markdown, code blocks, quotes and paragraphs, line by line.
+func renderMarkdown(body string, emoji []customEmoji) string {
+	var rendered strings.Builder
+	var paragraph, quote []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			rendered.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+		if len(quote) > 0 {
+			rendered.WriteString("<blockquote>" + strings.Join(quote, "<br>") + "</blockquote>")
+			quote = nil
+		}
+	}
+	lines := strings.Split(body, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(line), codeFence):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), codeFence); i++ {
+				code = append(code, lines[i])
+			}
+			rendered.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+		case strings.HasPrefix(line, ">"):
+			if len(paragraph) > 0 {
+				flush()
+			}
+			quote = append(quote, renderInline(strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "), emoji))
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			if len(quote) > 0 {
+				flush()
+			}
+			paragraph = append(paragraph, renderInline(line, emoji))
+		}
+	}
+	flush()
+	return rendered.String()
+}
+
+// renderInline - Renders the inline markdown of a line. Code spans and links are swapped out for placeholders
+// while the emphasis is rendered so that their contents are left alone. So are custom emoji images.
+func renderInline(line string, emoji []customEmoji) string {
+	var parts []string
+	hold := func(part string) string {
+		parts = append(parts, part)
+		return "\x00" + strconv.Itoa(len(parts)-1) + "\x00"
+	}
+	line = html.EscapeString(strings.ReplaceAll(line, "\x00", ""))
+	line = inlineCodePattern.ReplaceAllStringFunc(line, func(code string) string {
+		return hold("<code>" + inlineCodePattern.FindStringSubmatch(code)[1] + "</code>")
+	})
+	line = markdownInlineLinkPattern.ReplaceAllStringFunc(line, func(link string) string {
+		match := markdownInlineLinkPattern.FindStringSubmatch(link)
+		if !isSafeLink(html.UnescapeString(match[2])) {
+			return match[1]
+		}
+		return hold(`<a href="` + match[2] + `" rel="nofollow noopener noreferrer" target="_blank">` + match[1] + "</a>")
+	})
+	line = renderCustomEmoji(line, emoji, hold)
+	line = boldPattern.ReplaceAllString(line, "<strong>$1$2</strong>")
+	line = italicPattern.ReplaceAllString(line, "<em>$1</em>")
+	line = underscorePattern.ReplaceAllString(line, "$1<em>$2</em>$3")
+	// Held parts can hold others, like a code span in the text of a link. Each part only holds earlier ones so this ends.
+	for placeholder.MatchString(line) {
+		line = placeholder.ReplaceAllStringFunc(line, func(held string) string {
+			index, _ := strconv.Atoi(placeholder.FindStringSubmatch(held)[1])
+			return parts[index]
+		})
+	}
+	return line
+}
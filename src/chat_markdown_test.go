@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	assert.Equal(t, "<p><strong>bold</strong> <em>it</em> <em>also</em> snake_case_name <code>**x**</code></p>",
+		renderMessage("**bold** *it* _also_ snake_case_name `**x**`", FormatMarkdown, nil))
+	assert.Equal(t, `<p><a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer" target="_blank">site</a> click</p>`,
+		renderMessage("[site](https://example.com/?a=1&b=2) [click](javascript:evil)", FormatMarkdown, nil))
+	assert.Equal(t, "<blockquote>quoted<br>&lt;b&gt;</blockquote><p>reply</p>", renderMessage("> quoted\n> <b>\nreply", FormatMarkdown, nil))
+	assert.Equal(t, "<pre><code>if a &lt; b {\n}</code></pre>", renderMessage("```\nif a < b {\n}\n```", FormatMarkdown, nil))
+	assert.Equal(t, "<p>&lt;script&gt;**not bold**</p>", renderMessage("<script>**not bold**", FormatPlain, nil))
+	assert.Equal(t, `<p><a href="https://a.example" rel="nofollow noopener noreferrer" target="_blank"><code>x</code></a></p>`,
+		renderMessage("[`x`](https://a.example)", FormatMarkdown, nil))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Mentions of these names notify everyone on the channel instead of a single user.
+const (
+	MentionChannel = "channel"
+	MentionHere    = "here"
+)
+
+// maxMentions - How many different names one message can mention. The rest are left as plain text.
+const maxMentions = 10
+
+// mentionPattern - An @ that starts a word followed by a name. Names can not contain spaces.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([^\s@]+)`)
+
+// parseMentions - The distinct names mentioned in the body, in the order they first appear.
+func parseMentions(body string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.TrimRight(match[1], ".,!?:;)\"'")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if len(names) == maxMentions {
+			break
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolveMentions - The connections of the users mentioned in the body and the mentioned names nobody online has.
+// @channel mentions everyone on the channel of the sender and @here the ones that are online and not away, busy or idle.
+// Only channel admins can mention the whole channel. Everyone else can only mention users by name.
+func resolveMentions(body string, user *User) (online []*User, offline []string) {
+	found := map[*User]bool{}
+	var checkedChannelAdmin, channelAdmin bool
+	for _, name := range parseMentions(body) {
+		channelMention := strings.EqualFold(name, MentionChannel) || strings.EqualFold(name, MentionHere)
+		if channelMention && !checkedChannelAdmin {
+			channelAdmin = isChannelAdmin(user, user.CurrentChannelId)
+			checkedChannelAdmin = true
+		}
+		if channelMention && !channelAdmin {
+			continue
+		}
+		var matched bool
+		Users.Range(func(key, value interface{}) bool {
+			target := value.(*User)
+			if channelMention && target.CurrentChannelId != user.CurrentChannelId {
+				return true
+			}
+			if status, _ := target.getPresence(); strings.EqualFold(name, MentionHere) && status != PresenceOnline {
+				return true
+			}
+			if !channelMention && !strings.EqualFold(target.Name, name) {
+				return true
+			}
+			matched = true
+			if target != user && !found[target] {
+				found[target] = true
+				online = append(online, target)
+			}
+			return true
+		})
+		if !matched && !channelMention {
+			offline = append(offline, name)
+		}
+	}
+	return online, offline
+}
+
+// mentionedNames - The names attached to the message. Users connected more than once are listed once.
+func mentionedNames(online []*User, offline []string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, target := range online {
+		if !seen[target.Name] {
+			seen[target.Name] = true
+			names = append(names, target.Name)
+		}
+	}
+	return append(names, offline...)
+}
+
+// mentionNotice - What a mentioned user who may not see the channel gets: where and by whom, but not what.
+func mentionNotice(message EventData) EventData {
+	return EventData{Id: message.Id, ChannelId: message.ChannelId, Event: message.Event, Name: message.Name, CreatedDate: message.CreatedDate}
+}
+
+// isPrivateChannel - Whether the channel of a message is private. Channels that can not be read count as private.
+func isPrivateChannel(user *User, channelId string) bool {
+	if channelId == "" {
+		return false
+	}
+	channel, err := readChannel(user, channelId)
+	if err != nil {
+		log.Print("isPrivateChannel():", err)
+		return true
+	}
+	return channel.Private
+}
+
+// notifyMentions - Sends the message as a mention notification to the mentioned users wherever they are, and queues
+// it in the inbox of the mentioned names that are not online. Mentions on private channels only carry the message to
+// the ones who can see the channel. Everyone else gets a notice without it.
+func notifyMentions(user *User, message EventData, online []*User, offline []string) {
+	if user.isShadowBanned() || (len(online) == 0 && len(offline) == 0) {
+		return
+	}
+	private := isPrivateChannel(user, message.ChannelId)
+	for _, target := range online {
+		if !canDeliver(user, target, true) {
+			continue
+		}
+		mention := message
+		if private && target.CurrentChannelId != message.ChannelId && !hasChannelAccess(target, message.ChannelId) {
+			mention = mentionNotice(message)
+		}
+		jsonMessage, err := json.Marshal(mention)
+		if err != nil {
+			log.Print("notifyMentions():", err)
+			return
+		}
+		sendSystemMessage(string(jsonMessage), target, EventMention)
+	}
+	if private {
+		// The access of users who are not online can not be checked.
+		message = mentionNotice(message)
+	}
+	go queueOfflineMentions(offline, message)
+}
+
+// queueOfflineMentions - Queues the message in the inbox of the mentioned names that are registered accounts.
+// Any other word after an @ is left alone.
+func queueOfflineMentions(offline []string, message EventData) {
+	for _, name := range offline {
+		account, err := getAccount(name)
+		if err != nil || account.Username == "" {
+			continue
+		}
+		queueInboxItem(account.Username, InboxMention, message)
+	}
+}
+
+// sendChatMessage - Sends a chat message of the user to their channel with its html rendering and notifies everyone
+// mentioned in it.
+func sendChatMessage(user *User, message EventData) {
+	applyEmoji(&message)
+	online, offline := resolveMentions(message.Body, user)
+	message.Mentions = mentionedNames(online, offline)
+	message.Html = renderMessage(message.Body, message.Format, message.Emoji)
+	sendEventData(user, message, true, sendToAllOnChannelFilter)
+	recordMessage(user, message.ChannelId)
+	go sendLinkPreviews(user, message)
+	notifyMentions(user, message, online, offline)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob", "here"}, parseMentions("@alice, @bob and @Alice! ping @here"))
+	assert.Empty(t, parseMentions("mail me at someone@example.com"))
+}
+
+func TestMentionNotifiesTheMentionedUser(t *testing.T) {
+	sender, server := testSetup(t)
+	mentioned, otherServer := testSetup(t)
+	defer func() {
+		sender.Close()
+		mentioned.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	readUntil(t, sender, EventJoin)
+	mentionedName := readUntil(t, mentioned, EventJoin).Body
+
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "hello @" + mentionedName + " and @nobodyonline"})
+	assert.Nil(t, sender.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, sender, EventMessage)
+	assert.Equal(t, []string{mentionedName, "nobodyonline"}, message.Mentions)
+
+	var notification EventData
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, mentioned, EventMention).Body), &notification))
+	assert.Equal(t, message.Id, notification.Id)
+}
+
+func TestOnlyChannelAdminsMentionTheChannel(t *testing.T) {
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer os.Unsetenv("CHAT_ADMINS")
+	guest := &User{Name: "guest", CurrentChannelId: "mentions"}
+	member := &User{Name: "member", Token: "member", CurrentChannelId: "mentions"}
+	admin := &User{Name: "boss", Token: "boss", CurrentChannelId: "mentions"}
+	for _, user := range []*User{guest, member, admin} {
+		Users.Store(user, user)
+		defer Users.Delete(user)
+	}
+	for _, user := range []*User{guest, member} {
+		online, offline := resolveMentions("hey @channel", user)
+		assert.Empty(t, online)
+		assert.Empty(t, offline)
+	}
+	online, _ := resolveMentions("hey @channel", admin)
+	assert.ElementsMatch(t, []*User{guest, member}, online)
+}
+
+func TestOfflineMentionsOnlyReachAccounts(t *testing.T) {
+	accounts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"friend"`) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"username":"Friend"}`))
+	}))
+	var queued atomic.Int32
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `"name":"Friend"`)
+		queued.Add(1)
+	}))
+	os.Setenv("CHAT_USER_INFO_URL", accounts.URL)
+	os.Setenv("CHAT_INBOX_URL", inbox.URL)
+	defer func() {
+		accounts.Close()
+		inbox.Close()
+		os.Unsetenv("CHAT_USER_INFO_URL")
+		os.Unsetenv("CHAT_INBOX_URL")
+	}()
+	queueOfflineMentions([]string{"friend", "nothing", "word"}, EventData{Id: "1", Body: "@friend @nothing @word"})
+	assert.Eventually(t, func() bool { return queued.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), queued.Load())
+}
+
+func TestPrivateChannelMentionsOnlyReachMembers(t *testing.T) {
+	channels := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request channelGenericDTO
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		if !strings.HasPrefix(request.CreatorToken, "member") {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"name":"secret","private":true,"admin":"someone"}`))
+	}))
+	accounts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"username":"away"}`))
+	}))
+	queued := make(chan string, 1)
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queued <- string(body)
+	}))
+	os.Setenv("CHAT_CHANNEL_LIST_URL", channels.URL)
+	os.Setenv("CHAT_USER_INFO_URL", accounts.URL)
+	os.Setenv("CHAT_INBOX_URL", inbox.URL)
+	outsiderWs, server := testSetup(t)
+	memberWs, otherServer := testSetup(t)
+	defer func() {
+		outsiderWs.Close()
+		memberWs.Close()
+		server.Close()
+		otherServer.Close()
+		channels.Close()
+		accounts.Close()
+		inbox.Close()
+		os.Unsetenv("CHAT_CHANNEL_LIST_URL")
+		os.Unsetenv("CHAT_USER_INFO_URL")
+		os.Unsetenv("CHAT_INBOX_URL")
+	}()
+	outsider := findUserByName(readUntil(t, outsiderWs, EventJoin).Body)
+	member := findUserByName(readUntil(t, memberWs, EventJoin).Body)
+	member.Token = "member-token"
+	sender := &User{Name: "sender", account: "sender", Token: "member-sender", CurrentChannelId: "secret"}
+
+	message := EventData{Id: "secretmention", ChannelId: "secret", Event: EventMessage, Name: "sender", Body: "the plans"}
+	notifyMentions(sender, message, []*User{outsider, member}, []string{"away"})
+	var mention EventData
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, outsiderWs, EventMention).Body), &mention))
+	assert.Equal(t, "secretmention", mention.Id)
+	assert.Empty(t, mention.Body, "Users who can not see the channel only get a notice.")
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, memberWs, EventMention).Body), &mention))
+	assert.Equal(t, "the plans", mention.Body)
+	select {
+	case item := <-queued:
+		assert.NotContains(t, item, "the plans")
+	case <-time.After(time.Second):
+		t.Error("The offline mention should be queued.")
+	}
+}
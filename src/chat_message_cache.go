@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// messageCacheSize - How many of the latest chat messages are kept in memory for lookups by id.
+const messageCacheSize = 1000
+
+// messageCache - The latest chat messages by id. The oldest message is dropped when the cache is full.
+type messageCache struct {
+	mutex    sync.Mutex
+	messages map[string]EventData
+	order    []string
+	size     int
+}
+
+var errMessageNotFound = errors.New("message not found. It may be too old")
+
+// sentMessages - The latest chat messages sent on any channel.
+var sentMessages = newMessageCache(messageCacheSize)
+
+func newMessageCache(size int) *messageCache {
+	return &messageCache{messages: map[string]EventData{}, size: size}
+}
+
+func (c *messageCache) add(message EventData) {
+	if message.Id == "" {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.messages[message.Id]; !ok {
+		c.order = append(c.order, message.Id)
+	}
+	c.messages[message.Id] = message
+	if len(c.order) > c.size {
+		delete(c.messages, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// addIfMissing - Adds a message unless it is already cached. The cached copy is newer than anything loaded from the history.
+func (c *messageCache) addIfMissing(message EventData) {
+	if _, ok := c.get(message.Id); !ok {
+		c.add(message)
+	}
+}
+
+// update - Runs the update function on a cached message while holding the lock.
+func (c *messageCache) update(id string, updateFn func(message *EventData) error) (EventData, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	message, ok := c.messages[id]
+	if !ok {
+		return message, errMessageNotFound
+	}
+	if err := updateFn(&message); err != nil {
+		return message, err
+	}
+	c.messages[id] = message
+	return message, nil
+}
+
+func (c *messageCache) remove(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.messages[id]; !ok {
+		return
+	}
+	delete(c.messages, id)
+	for i, cached := range c.order {
+		if cached == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *messageCache) get(id string) (EventData, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	message, ok := c.messages[id]
+	return message, ok
+}
+
+// find - The cached messages the match function accepts, oldest first.
+func (c *messageCache) find(matchFn func(message EventData) bool) []EventData {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var found []EventData
+	for _, id := range c.order {
+		if message := c.messages[id]; matchFn(message) {
+			found = append(found, message)
+		}
+	}
+	return found
+}
+
+// newMessageId - A random id for a chat message.
+func newMessageId() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(bytes)
+}
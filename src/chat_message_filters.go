@@ -5,11 +5,18 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// canDeliver - Nothing is delivered from users on the ignore list of the recipient, and no chat content from shadow
+// banned users is delivered to anyone but themselves. Notices about them, like leaving, still are so that the ban
+// does not show.
+func canDeliver(from *User, to *User, content bool) bool {
+	return from == to || (!to.isIgnoring(from) && (!content || !from.isShadowBanned()))
+}
+
 // sends the body string data to all connected clients on the same channel
-func sendToAllOnChannelFilter(user *User, jsonResponse []byte) func(key any, value any) bool  {
+func sendToAllOnChannelFilter(user *User, jsonResponse []byte, content bool) func(key any, value any) bool  {
 	return func(key, value interface{}) bool {
 		var userValue = value.(*User)
-		if userValue.CurrentChannelId == user.CurrentChannelId {
+		if userValue.CurrentChannelId == user.CurrentChannelId && canDeliver(user, userValue, content) {
 			if err := userValue.write(websocket.TextMessage, jsonResponse); err != nil {
 				log.Print("sendToAllOnChannelFilter():", err)
 			}
@@ -17,10 +24,30 @@ func sendToAllOnChannelFilter(user *User, jsonResponse []byte) func(key any, val
 		return true
 	}
 }
+
+// sendToChannelFilter - Sends to everyone on the channel, wherever the sender is now. For events that are sent
+// after the sender may have moved on.
+func sendToChannelFilter(channelId string) messageFn {
+	return func(user *User, jsonResponse []byte, content bool) func(key any, value any) bool {
+		return func(key, value interface{}) bool {
+			userValue := value.(*User)
+			if userValue.CurrentChannelId == channelId && canDeliver(user, userValue, content) {
+				if err := userValue.write(websocket.TextMessage, jsonResponse); err != nil {
+					log.Print("sendToChannelFilter():", err)
+				}
+			}
+			return true
+		}
+	}
+}
+
 // sends the body string data to all connected clients
-func sendToAllFilter(user *User, jsonResponse []byte) func(key any, value any) bool  {
+func sendToAllFilter(user *User, jsonResponse []byte, content bool) func(key any, value any) bool  {
 	return func(key, value interface{}) bool {
 		var userValue = value.(*User)
+		if !canDeliver(user, userValue, content) {
+			return true
+		}
 		if err := userValue.write(websocket.TextMessage, jsonResponse); err != nil {
 			log.Print("sendToAllFilter():", err)
 		}
@@ -29,10 +56,10 @@ func sendToAllFilter(user *User, jsonResponse []byte) func(key any, value any) b
 }
 
 // sends the body string data to all connected clients on the same channel except the parameter given client
-func sendToOtherOnChannelFilter(user *User, jsonResponse []byte) func(key any, value any) bool  {
+func sendToOtherOnChannelFilter(user *User, jsonResponse []byte, content bool) func(key any, value any) bool  {
 	return func(key, value interface{}) bool {
 		userValue := value.(*User)
-		if userValue != user && userValue.CurrentChannelId == user.CurrentChannelId {
+		if userValue != user && userValue.CurrentChannelId == user.CurrentChannelId && canDeliver(user, userValue, content) {
 			if err := userValue.write(websocket.TextMessage, jsonResponse); err != nil {
 				log.Print("sendToOtherOnChannelFilter():", err)
 			}
@@ -42,10 +69,10 @@ func sendToOtherOnChannelFilter(user *User, jsonResponse []byte) func(key any, v
 }
 
 // sends the body string data to all connected clients except the parameter given client
-func sendToOtherEverywhereFilter(user *User, jsonResponse []byte) func(key any, value any) bool {
+func sendToOtherEverywhereFilter(user *User, jsonResponse []byte, content bool) func(key any, value any) bool {
 	return func(key, value interface{}) bool {
 		userValue := value.(*User)
-		if userValue != user {
+		if userValue != user && canDeliver(user, userValue, content) {
 			if err := userValue.write(websocket.TextMessage, jsonResponse); err != nil {
 				log.Print("sendToOtherEverywhereFilter():", err)
 			}
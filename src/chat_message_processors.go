@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Possible outcomes of a message processor.
+const (
+	messageAllowed = iota
+	messageModified
+	messageRejected
+)
+
+// processorResult - What a message processor decided to do with a message. Reason is sent to the author
+// when the message is modified or rejected.
+type processorResult struct {
+	Outcome int
+	Body    string
+	Reason  string
+}
+
+type messageProcessor func(body string, format string, user *User) processorResult
+
+// messageProcessors - The inbound message processors. Run in order for every chat message before it is sent anywhere.
+var messageProcessors = []messageProcessor{
+	wordListProcessor,
+	capsProcessor,
+	repeatProcessor,
+	linkCountProcessor,
+}
+
+type recentMessage struct {
+	body   string
+	sentAt time.Time
+}
+
+func allow(body string) processorResult {
+	return processorResult{Outcome: messageAllowed, Body: body}
+}
+
+func modify(body string, reason string) processorResult {
+	return processorResult{Outcome: messageModified, Body: body, Reason: reason}
+}
+
+func reject(reason string) processorResult {
+	return processorResult{Outcome: messageRejected, Reason: reason}
+}
+
+// runMessageProcessors - Runs the message in the given format through the processors. Returns the possibly modified
+// body, or false if a processor rejected the message.
+func runMessageProcessors(body string, format string, user *User) (string, bool) {
+	for _, processor := range messageProcessors {
+		result := processor(body, format, user)
+		switch result.Outcome {
+		case messageRejected:
+			sendSystemMessage(result.Reason, user, EventErrorNotification)
+			return "", false
+		case messageModified:
+			sendSystemMessage(result.Reason, user, EventNotification)
+			body = result.Body
+		}
+	}
+	return body, true
+}
+
+var wordListMutex sync.Mutex
+var wordListSource string
+var wordListPattern *regexp.Regexp
+
+// filteredWordsPattern - FILTERED_WORDS compiled into a pattern. Recompiled only when the env changes.
+func filteredWordsPattern() *regexp.Regexp {
+	words := os.Getenv("FILTERED_WORDS")
+	wordListMutex.Lock()
+	defer wordListMutex.Unlock()
+	if words == wordListSource {
+		return wordListPattern
+	}
+	var quoted []string
+	for _, word := range strings.Split(words, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	wordListSource = words
+	wordListPattern = nil
+	if len(quoted) > 0 {
+		wordListPattern = regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return wordListPattern
+}
+
+// wordListProcessor - Masks the words in FILTERED_WORDS, or rejects the whole message when FILTERED_WORDS_MODE=reject.
+func wordListProcessor(body string, _ string, _ *User) processorResult {
+	pattern := filteredWordsPattern()
+	if pattern == nil || !pattern.MatchString(body) {
+		return allow(body)
+	}
+	if os.Getenv("FILTERED_WORDS_MODE") == "reject" {
+		return reject("Your message contains words that are not allowed here.")
+	}
+	masked := pattern.ReplaceAllStringFunc(body, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	})
+	return modify(masked, "Some words in your message were masked.")
+}
+
+// capsProcessor - Lowercases messages that are mostly capital letters. The limit is MAX_CAPS_PERCENT of the letters.
+// Short messages and code are left alone, and so are links since their paths can be case sensitive.
+func capsProcessor(body string, format string, _ *User) processorResult {
+	if format == FormatCode {
+		return allow(body)
+	}
+	var letters, upper int
+	for _, r := range linkPattern.ReplaceAllString(body, " ") {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters < getEnvInt("MIN_CAPS_CHECK_LETTERS", 10) || upper*100 <= letters*getEnvInt("MAX_CAPS_PERCENT", 70) {
+		return allow(body)
+	}
+	var lowered strings.Builder
+	start := 0
+	for _, link := range linkPattern.FindAllStringIndex(body, -1) {
+		lowered.WriteString(strings.ToLower(body[start:link[0]]))
+		lowered.WriteString(body[link[0]:link[1]])
+		start = link[1]
+	}
+	lowered.WriteString(strings.ToLower(body[start:]))
+	return modify(lowered.String(), "Please don't shout.")
+}
+
+// repeatProcessor - Rejects a message when the user has already sent the same message REPEAT_LIMIT times
+// within REPEAT_WINDOW_SECONDS.
+func repeatProcessor(body string, _ string, user *User) processorResult {
+	limit := getEnvInt("REPEAT_LIMIT", 3)
+	window := time.Duration(getEnvInt("REPEAT_WINDOW_SECONDS", 30)) * time.Second
+	now := time.Now()
+	normalized := strings.ToLower(strings.Join(strings.Fields(body), " "))
+	var recent []recentMessage
+	var repeats int
+	for _, message := range user.recentMessages {
+		if now.Sub(message.sentAt) <= window {
+			recent = append(recent, message)
+			if message.body == normalized {
+				repeats++
+			}
+		}
+	}
+	if repeats >= limit {
+		user.recentMessages = recent
+		return reject("You have already sent that message. Please don't repeat yourself.")
+	}
+	user.recentMessages = append(recent, recentMessage{body: normalized, sentAt: now})
+	return allow(body)
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+// linkCountProcessor - Rejects messages with more than MAX_LINKS links.
+func linkCountProcessor(body string, _ string, _ *User) processorResult {
+	if len(linkPattern.FindAllStringIndex(body, -1)) > getEnvInt("MAX_LINKS", 3) {
+		return reject("Your message contains too many links.")
+	}
+	return allow(body)
+}
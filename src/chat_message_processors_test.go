@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordListProcessor(t *testing.T) {
+	os.Setenv("FILTERED_WORDS", "darn, heck")
+	defer os.Unsetenv("FILTERED_WORDS")
+	result := wordListProcessor("Darn it, what the heck. Checkmate.", FormatPlain, nil)
+	assert.Equal(t, messageModified, result.Outcome)
+	assert.Equal(t, "**** it, what the ****. Checkmate.", result.Body)
+	assert.Equal(t, messageAllowed, wordListProcessor("Nothing to see here", FormatPlain, nil).Outcome)
+
+	os.Setenv("FILTERED_WORDS_MODE", "reject")
+	defer os.Unsetenv("FILTERED_WORDS_MODE")
+	assert.Equal(t, messageRejected, wordListProcessor("darn", FormatPlain, nil).Outcome)
+}
+
+func TestCapsProcessor(t *testing.T) {
+	result := capsProcessor("WHY IS EVERYONE SHOUTING", FormatPlain, nil)
+	assert.Equal(t, messageModified, result.Outcome)
+	assert.Equal(t, "why is everyone shouting", result.Body)
+	assert.Equal(t, messageAllowed, capsProcessor("OK LOL", FormatPlain, nil).Outcome, "Short messages are not checked.")
+	assert.Equal(t, messageAllowed, capsProcessor("I talked with NASA and the ESA today", FormatPlain, nil).Outcome)
+	assert.Equal(t, messageAllowed, capsProcessor("const MAX_SIZE = DEFAULT_LIMIT", FormatCode, nil).Outcome, "Code is not checked.")
+	result = capsProcessor("LOOK AT THIS https://a.example/Path?Key=Value NOW", FormatPlain, nil)
+	assert.Equal(t, "look at this https://a.example/Path?Key=Value now", result.Body, "Links keep their case.")
+}
+
+func TestRepeatProcessor(t *testing.T) {
+	user := &User{}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, messageAllowed, repeatProcessor("buy  my stuff", FormatPlain, user).Outcome)
+	}
+	assert.Equal(t, messageRejected, repeatProcessor("Buy my stuff", FormatPlain, user).Outcome)
+	assert.Equal(t, messageAllowed, repeatProcessor("something else", FormatPlain, user).Outcome)
+}
+
+func TestLinkCountProcessor(t *testing.T) {
+	assert.Equal(t, messageAllowed, linkCountProcessor("see https://a.com and www.b.com", FormatPlain, nil).Outcome)
+	assert.Equal(t, messageRejected, linkCountProcessor("http://a.com http://b.com http://c.com http://d.com", FormatPlain, nil).Outcome)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMessageParts - How many parts one multi-part message can have.
+const maxMessageParts = 64
+
+// multipartLimitFactor - How many times the limit for one message of the user a message sent in parts can be.
+const multipartLimitFactor = 8
+
+// messagePartTimeout - How long the parts of a message are waited for before the message is dropped.
+const messagePartTimeout = time.Minute
+
+// channelMessageLimits - The message size limit of each channel that has one, keyed by channel id.
+var channelMessageLimits sync.Map
+
+// messageSizePolicy - Message size limits in bytes. See env/README.md.
+type messageSizePolicy struct {
+	guestBytes      int
+	registeredBytes int
+	adminBytes      int
+	multipartBytes  int
+}
+
+func loadMessageSizePolicy() messageSizePolicy {
+	return messageSizePolicy{
+		guestBytes:      getEnvInt("MAX_MESSAGE_BYTES", 512),
+		registeredBytes: getEnvInt("MAX_MESSAGE_BYTES_REGISTERED", 2000),
+		adminBytes:      getEnvInt("MAX_MESSAGE_BYTES_ADMIN", 8000),
+		multipartBytes:  getEnvInt("MAX_MULTIPART_MESSAGE_BYTES", 32*1024),
+	}
+}
+
+func setChannelMessageLimit(channelId string, maxBytes int) {
+	if maxBytes <= 0 {
+		channelMessageLimits.Delete(channelId)
+	} else {
+		channelMessageLimits.Store(channelId, maxBytes)
+	}
+}
+
+// messageLimit - How many bytes one message of the user can have on their current channel.
+func messageLimit(user *User) int {
+	policy := loadMessageSizePolicy()
+	limit := policy.guestBytes
+	if !user.isGuest() {
+		limit = policy.registeredBytes
+	}
+	if channelLimit, ok := channelMessageLimits.Load(user.CurrentChannelId); ok {
+		limit = channelLimit.(int)
+	}
+	if isAdmin(user) && policy.adminBytes > limit {
+		limit = policy.adminBytes
+	}
+	return min(limit, maxFrameSize)
+}
+
+// multipartLimit - How many bytes a message the user sends in parts can have. Zero if multi-part messages are off.
+func multipartLimit(user *User) int {
+	maxBytes := loadMessageSizePolicy().multipartBytes
+	if maxBytes <= 0 {
+		return 0
+	}
+	return min(maxBytes, messageLimit(user)*multipartLimitFactor)
+}
+
+// checkMessageSize - Tells the user and returns false if the body is over the limit.
+func checkMessageSize(body string, maxBytes int, user *User) bool {
+	if len(body) > maxBytes {
+		sendSystemMessage("Your message is too long. The limit is "+strconv.Itoa(maxBytes)+" bytes. Send long text in parts.", user, EventErrorNotification)
+		return false
+	}
+	return true
+}
+
+// messagePartDTO - The body of a message part event. Parts of the same message share the id the client chose.
+type messagePartDTO struct {
+	Id    string `json:"id"`
+	Index int    `json:"index"`
+	Total int    `json:"total"`
+	Body  string `json:"body"`
+}
+
+// partialMessage - The parts of a message received so far. Only touched from the reader of the connection.
+type partialMessage struct {
+	id        string
+	total     int
+	parts     []string
+	received  int
+	size      int
+	startedAt time.Time
+}
+
+// addMessagePart - Adds the part to the message it belongs to. Returns the whole body when the last part arrives.
+// A connection can send one multi-part message at a time. Starting a new one drops the old one.
+func addMessagePart(part messagePartDTO, user *User) (string, bool, error) {
+	maxBytes := multipartLimit(user)
+	if maxBytes <= 0 {
+		return "", false, errors.New("multi-part messages are turned off")
+	}
+	if part.Id == "" || part.Total < 1 || part.Total > maxMessageParts || part.Index < 0 || part.Index >= part.Total {
+		return "", false, errors.New("malformed message part")
+	}
+	pending := user.partialMessage
+	if pending == nil || pending.id != part.Id || time.Since(pending.startedAt) > messagePartTimeout {
+		pending = &partialMessage{id: part.Id, total: part.Total, parts: make([]string, part.Total), startedAt: time.Now()}
+		user.partialMessage = pending
+	}
+	if part.Total != pending.total {
+		user.partialMessage = nil
+		return "", false, errors.New("malformed message part")
+	}
+	if pending.parts[part.Index] == "" {
+		pending.received++
+	}
+	pending.size += len(part.Body) - len(pending.parts[part.Index])
+	pending.parts[part.Index] = part.Body
+	if pending.size > maxBytes {
+		user.partialMessage = nil
+		return "", false, errors.New("that message is too long. The limit is " + strconv.Itoa(maxBytes) + " bytes")
+	}
+	if pending.received < pending.total {
+		return "", false, nil
+	}
+	user.partialMessage = nil
+	return strings.Join(pending.parts, ""), true, nil
+}
+
+// handleMessagePartEvent - Collects a message sent in parts and sends it like any other message once it is whole.
+// The format and attachments of the message are taken from the event of the last part. Every part counts against
+// the message rate of the user.
+func handleMessagePartEvent(event EventData, user *User) {
+	var part messagePartDTO
+	if err := json.Unmarshal([]byte(event.Body), &part); err != nil || part.Body == "" {
+		sendSystemMessage("Malformed message part.", user, EventErrorNotification)
+		return
+	}
+	if !checkMessageSize(part.Body, messageLimit(user), user) || !takeMessageToken(user, loadFloodPolicy(), time.Now()) {
+		user.partialMessage = nil
+		return
+	}
+	message, complete, err := addMessagePart(part, user)
+	if err != nil {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return
+	}
+	if complete {
+		sendUserMessage(EventData{Body: message, Format: event.Format, Attachments: event.Attachments}, multipartLimit(user), user)
+	}
+}
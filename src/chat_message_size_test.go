@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageLimits(t *testing.T) {
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer os.Unsetenv("CHAT_ADMINS")
+	guest := &User{Name: "guest", CurrentChannelId: "logs"}
+	registered := &User{Name: "alice", Token: "token", CurrentChannelId: "logs"}
+	admin := &User{Name: "boss", Token: "token", CurrentChannelId: "logs"}
+	assert.Equal(t, 512, messageLimit(guest))
+	assert.Equal(t, 2000, messageLimit(registered))
+	assert.Equal(t, 8000, messageLimit(admin))
+
+	os.Setenv("MAX_MULTIPART_MESSAGE_BYTES", "32768")
+	defer os.Unsetenv("MAX_MULTIPART_MESSAGE_BYTES")
+	assert.Equal(t, 512*multipartLimitFactor, multipartLimit(guest), "Guests can not get around their limit with parts.")
+	assert.Equal(t, 32768, multipartLimit(admin))
+
+	setChannelMessageLimit("logs", 16000)
+	defer setChannelMessageLimit("logs", 0)
+	assert.Equal(t, 16000, messageLimit(guest))
+	assert.Equal(t, 16000, messageLimit(admin))
+}
+
+func TestMessagePartsOutOfOrder(t *testing.T) {
+	os.Setenv("MAX_MULTIPART_MESSAGE_BYTES", "10")
+	defer os.Unsetenv("MAX_MULTIPART_MESSAGE_BYTES")
+	user := &User{}
+	_, complete, err := addMessagePart(messagePartDTO{Id: "a", Index: 1, Total: 2, Body: "world"}, user)
+	assert.Nil(t, err)
+	assert.False(t, complete)
+	message, complete, err := addMessagePart(messagePartDTO{Id: "a", Index: 0, Total: 2, Body: "hello"}, user)
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, "helloworld", message)
+
+	addMessagePart(messagePartDTO{Id: "b", Index: 0, Total: 2, Body: "hello"}, user)
+	_, _, err = addMessagePart(messagePartDTO{Id: "b", Index: 1, Total: 2, Body: "world!"}, user)
+	assert.NotNil(t, err, "The whole message can not be over the limit.")
+	assert.Nil(t, user.partialMessage)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxOpenReports - The moderation queue does not take more reports than this.
+const maxOpenReports = 1000
+
+// maxReportReasonLength - Longer report reasons are cut. In characters.
+const maxReportReasonLength = 256
+
+// report - A message reported by a user, waiting for a moderator.
+type report struct {
+	Id          string    `json:"id"`
+	MessageId   string    `json:"messageId"`
+	ChannelId   string    `json:"channelId"`
+	Reporter    string    `json:"reporter"`
+	Reported    string    `json:"reported"`
+	Body        string    `json:"body"`
+	Reason      string    `json:"reason"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+type messageDeleteDTO struct {
+	CreatorToken string `json:"creatorToken"`
+	MessageId    string `json:"messageId"`
+	ChannelId    string `json:"channelId"`
+}
+
+type resolveReportDTO struct {
+	Id         string `json:"id"`
+	Resolution string `json:"resolution"`
+}
+
+// reportQueue - The open reports in the order they came in. Resolved reports are removed from the queue
+// and only live on in the audit log.
+type reportQueue struct {
+	mutex   sync.Mutex
+	reports []report
+}
+
+var moderationQueue = &reportQueue{}
+
+func (q *reportQueue) add(newReport report) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.reports) >= maxOpenReports {
+		return errors.New("the moderation queue is full. Try again later")
+	}
+	for _, r := range q.reports {
+		if r.MessageId == newReport.MessageId && r.Reporter == newReport.Reporter {
+			return errors.New("you have already reported that message")
+		}
+	}
+	q.reports = append(q.reports, newReport)
+	return nil
+}
+
+func (q *reportQueue) list() []report {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]report{}, q.reports...)
+}
+
+func (q *reportQueue) resolve(id string) (report, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, r := range q.reports {
+		if r.Id == id {
+			q.reports = append(q.reports[:i], q.reports[i+1:]...)
+			return r, true
+		}
+	}
+	return report{}, false
+}
+
+// resolveReport - Removes the report from the queue and records who resolved it and how.
+func resolveReport(id string, moderator string, resolution string) error {
+	resolved, ok := moderationQueue.resolve(id)
+	if !ok {
+		return errors.New("no open report with that id")
+	}
+	audit(AuditReportResolve, moderator, resolved.Reported, resolved.ChannelId, "report "+resolved.Id+" on message "+resolved.MessageId+": "+resolution)
+	return nil
+}
+
+// notifyAdmins - Sends a notification to all the connected admins.
+func notifyAdmins(body string) {
+	Users.Range(func(key, value interface{}) bool {
+		if admin := value.(*User); isAdmin(admin) {
+			sendSystemMessage(body, admin, EventNotification)
+		}
+		return true
+	})
+}
+
+// reportReason - The reason of a report from the words of the command, cut to maxReportReasonLength.
+func reportReason(words []string) string {
+	reason := strings.TrimSpace(strings.Join(words, " "))
+	if runes := []rune(reason); len(runes) > maxReportReasonLength {
+		reason = string(runes[:maxReportReasonLength])
+	}
+	return reason
+}
+
+// handleReportCommand - /report <messageId> <reason>
+func handleReportCommand(params []string, user *User) error {
+	if len(params) < 3 {
+		return notEnoughParameters()
+	}
+	message, ok := sentMessages.get(params[1])
+	if !ok || message.Name == SystemName {
+		return errors.New("message not found. It may be too old to report")
+	}
+	reason := reportReason(params[2:])
+	newReport := report{Id: newMessageId(), MessageId: message.Id, ChannelId: message.ChannelId, Reporter: user.Name,
+		Reported: message.Name, Body: message.Body, Reason: reason, CreatedDate: time.Now()}
+	if err := moderationQueue.add(newReport); err != nil {
+		return err
+	}
+	audit(AuditReport, user.Name, message.Name, message.ChannelId, "report "+newReport.Id+" on message "+message.Id+": "+reason)
+	sendSystemMessage("Thank you. The message has been reported to the moderators.", user, EventNotification)
+	notifyAdmins(user.Name + " reported a message by " + message.Name + ". See '/reports'.")
+	return nil
+}
+
+// handleReportsCommand - /reports lists the open reports, /reports resolve <reportId> [resolution] resolves one.
+func handleReportsCommand(params []string, user *User) error {
+	if !isAdmin(user) {
+		return errors.New("only admins can do that")
+	}
+	if len(params) >= 3 && params[1] == "resolve" {
+		resolution := strings.Join(params[3:], " ")
+		if err := resolveReport(params[2], user.Name, resolution); err != nil {
+			return err
+		}
+		sendSystemMessage("Report "+params[2]+" resolved.", user, EventNotification)
+		return nil
+	}
+	if len(params) > 1 {
+		return notEnoughParameters()
+	}
+	jsonResponse, err := json.Marshal(moderationQueue.list())
+	if err != nil {
+		log.Print("handleReportsCommand():", err)
+		return genericError()
+	}
+	sendSystemMessage(string(jsonResponse), user, EventModerationQueue)
+	return nil
+}
+
+// handleKickCommand - /kick <nick> [reason] disconnects a user. Admins can kick anyone, channel admins
+// the users on their channel.
+func handleKickCommand(params []string, user *User) error {
+	if len(params) < 2 {
+		return notEnoughParameters()
+	}
+	target := findUserByName(params[1])
+	if target == nil {
+		return errors.New("no such user online")
+	}
+	if target == user {
+		return errors.New("you can not kick yourself")
+	}
+	if !isChannelAdmin(user, target.CurrentChannelId) || (isAdmin(target) && !isAdmin(user)) {
+		return errors.New("only admins can do that")
+	}
+	reason := strings.Join(params[2:], " ")
+	audit(AuditKick, user.Name, target.Name, target.CurrentChannelId, reason)
+	if reason != "" {
+		reason = " Reason: " + reason
+	}
+	sendSystemMessage("You have been kicked by "+user.Name+"."+reason, target, EventErrorNotification)
+	sendToOtherOnChannel(target.Name+" was kicked by "+user.Name+"."+reason, target, EventNotification, false, false)
+	target.Connection.Close()
+	return nil
+}
+
+// handleDeleteCommand - /delete <messageId> deletes a message from the history. Admins can delete anything, channel
+// admins the messages on their channel.
+func handleDeleteCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	message, ok := findChannelMessage(user.CurrentChannelId, params[1])
+	if !ok || message.Name == SystemName {
+		return errMessageNotFound
+	}
+	if !isChannelAdmin(user, message.ChannelId) {
+		return errors.New("only admins can do that")
+	}
+	jsonResponse, err := json.Marshal(messageDeleteDTO{CreatorToken: user.Token, MessageId: message.Id, ChannelId: message.ChannelId})
+	if err != nil {
+		log.Print("handleDeleteCommand():", err)
+		return genericError()
+	}
+	if _, err := apiRequest("DELETE", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_HISTORY_URL", nil); err != nil {
+		log.Print("handleDeleteCommand():", err)
+		return errors.New("error deleting the message")
+	}
+	sentMessages.remove(message.Id)
+	audit(AuditDelete, user.Name, message.Name, message.ChannelId, "message "+message.Id+": "+message.Body)
+	sendEventData(user, EventData{Event: EventMessageDelete, ChannelId: message.ChannelId, Body: message.Id, Name: SystemName,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToChannelFilter(message.ChannelId))
+	return nil
+}
+
+// requestAdmin - The admin behind the session cookie of the http request. Writes the error response and
+// returns false if there is none.
+func requestAdmin(responseWriter http.ResponseWriter, request *http.Request) (*User, bool) {
+	user, ok := requestUser(responseWriter, request)
+	if !ok {
+		return nil, false
+	}
+	if !isAdmin(user) {
+		writeJSONError(responseWriter, http.StatusForbidden, ErrorCodeForbidden, "only admins can do that")
+		return nil, false
+	}
+	return user, true
+}
+
+// requestUser - The logged in user making an http request. Answers the request with an error if there is none.
+func requestUser(responseWriter http.ResponseWriter, request *http.Request) (*User, bool) {
+	cookie := sessionCookie(request)
+	if cookie == "" {
+		writeJSONError(responseWriter, http.StatusUnauthorized, ErrorCodeUnauthorized, "must be logged in")
+		return nil, false
+	}
+	validationRes, err := validateToken(cookie)
+	if err != nil || validationRes.Username == "" {
+		writeJSONError(responseWriter, http.StatusUnauthorized, ErrorCodeUnauthorized, "invalid session")
+		return nil, false
+	}
+	return &User{Name: validationRes.Username, account: validationRes.Username, Token: cookie}, true
+}
+
+// moderationReportsRequest - GET lists the open reports.
+func moderationReportsRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	if _, ok := requestAdmin(responseWriter, request); !ok {
+		return
+	}
+	writeJSON(responseWriter, http.StatusOK, moderationQueue.list())
+}
+
+// moderationResolveRequest - POST resolves a report.
+func moderationResolveRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	var resolveRequest resolveReportDTO
+	if request.Method != http.MethodPost {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	admin, ok := requestAdmin(responseWriter, request)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(responseWriter, request.Body, maxRequestBodySize))
+	if err != nil || json.Unmarshal(body, &resolveRequest) != nil {
+		writeJSONError(responseWriter, http.StatusBadRequest, ErrorCodeBadRequest, "malformed request")
+		return
+	}
+	if err := resolveReport(resolveRequest.Id, admin.Name, resolveRequest.Resolution); err != nil {
+		writeJSONError(responseWriter, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+		return
+	}
+	writeJSON(responseWriter, http.StatusOK, resolveRequest)
+}
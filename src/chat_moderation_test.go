@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportQueue(t *testing.T) {
+	queue := &reportQueue{}
+	assert.Nil(t, queue.add(report{Id: "r1", MessageId: "m1", Reporter: "alice"}))
+	assert.NotNil(t, queue.add(report{Id: "r2", MessageId: "m1", Reporter: "alice"}), "The same user can not report the same message twice.")
+	assert.Nil(t, queue.add(report{Id: "r3", MessageId: "m1", Reporter: "bob"}))
+	assert.Len(t, queue.list(), 2)
+	resolved, ok := queue.resolve("r1")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", resolved.Reporter)
+	_, ok = queue.resolve("r1")
+	assert.False(t, ok)
+	assert.Len(t, queue.list(), 1)
+}
+
+func TestModerationEndpoints(t *testing.T) {
+	defer setupLogin(t)()
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	os.Setenv("AUDIT_LOG_FILE", auditFile)
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer func() {
+		os.Unsetenv("AUDIT_LOG_FILE")
+		os.Unsetenv("CHAT_ADMINS")
+	}()
+	moderationQueue = &reportQueue{}
+	moderationQueue.add(report{Id: "r1", MessageId: "m1", Reporter: "alice", Reported: "troll"})
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/http/chat/moderation/reports", nil)
+	recorder := httptest.NewRecorder()
+	moderationReportsRequest(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-alice"})
+	recorder = httptest.NewRecorder()
+	moderationReportsRequest(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	request = httptest.NewRequest(http.MethodGet, "/api/v1/http/chat/moderation/reports", nil)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-boss"})
+	recorder = httptest.NewRecorder()
+	moderationReportsRequest(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var reports []report
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &reports))
+	assert.Equal(t, "r1", reports[0].Id)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/http/chat/moderation/reports/resolve", strings.NewReader(`{"id":"r1","resolution":"warned"}`))
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-boss"})
+	recorder = httptest.NewRecorder()
+	moderationResolveRequest(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, moderationQueue.list())
+
+	auditLog, err := os.ReadFile(auditFile)
+	assert.Nil(t, err)
+	var entry auditEntry
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimSpace(string(auditLog))), &entry))
+	assert.Equal(t, AuditReportResolve, entry.Action)
+	assert.Equal(t, "boss", entry.Actor)
+	assert.Equal(t, "troll", entry.Target)
+}
+
+func TestModerationCommands(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"lobby","admin":"lobbyadmin"}`))
+	}))
+	os.Setenv("CHAT_CHANNEL_LIST_URL", server.URL)
+	os.Setenv("CHAT_HISTORY_URL", server.URL)
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer func() {
+		server.Close()
+		os.Unsetenv("CHAT_CHANNEL_LIST_URL")
+		os.Unsetenv("CHAT_HISTORY_URL")
+		os.Unsetenv("CHAT_ADMINS")
+	}()
+	channelAdmin := &User{Name: "lobbyadmin", Token: "token", CurrentChannelId: "lobby"}
+	boss := &User{Name: "boss", Token: "token", CurrentChannelId: "lobby"}
+	Users.Store(boss, boss)
+	assert.NotNil(t, handleKickCommand([]string{CommandKick, "boss"}, channelAdmin), "Channel admins can not kick admins.")
+	Users.Delete(boss)
+
+	message := EventData{Id: newMessageId(), Event: EventMessage, ChannelId: "lobby", Body: "spam", Name: "troll", CreatedDate: time.Now()}
+	sentMessages.add(message)
+	assert.Nil(t, handleDeleteCommand([]string{CommandDelete, message.Id}, channelAdmin))
+	_, ok := sentMessages.get(message.Id)
+	assert.False(t, ok)
+
+	reason := reportReason([]string{strings.Repeat("ä", maxReportReasonLength+10)})
+	assert.True(t, utf8.ValidString(reason))
+	assert.Equal(t, maxReportReasonLength, utf8.RuneCountInString(reason))
+}
+
+func TestAdminRightsFollowTheAccount(t *testing.T) {
+	channels := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"owned","admin":"owner"}`)
+	}))
+	os.Setenv("CHAT_CHANNEL_LIST_URL", channels.URL)
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer func() {
+		channels.Close()
+		os.Unsetenv("CHAT_CHANNEL_LIST_URL")
+		os.Unsetenv("CHAT_ADMINS")
+	}()
+	boss := &User{Name: "renamed", account: "boss", Token: "boss"}
+	owner := &User{Name: "alsorenamed", account: "owner", Token: "owner"}
+	assert.True(t, isAdmin(boss))
+	assert.True(t, isChannelAdmin(owner, "owned"))
+	assert.Equal(t, RoleChannelAdmin, channelRole(owner, "owner"))
+
+	impostor := &User{Name: "boss", account: "impostor", Token: "impostor"}
+	assert.False(t, isAdmin(impostor), "Taking the nick of an admin gives no rights.")
+	impostor.Name = "owner"
+	assert.False(t, isChannelAdmin(impostor, "owned"))
+	assert.Equal(t, RoleMember, channelRole(impostor, "owner"))
+}
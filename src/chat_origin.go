@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// originPolicy - Decides which browser origins may talk to the chat. Shared by the websocket and the http endpoints.
+//
+// ALLOWED_ORIGIN is a comma separated list. Each entry is one of:
+//   - a bare domain like "joonas.ninja", which allows it and its www. variant over http and https
+//   - a wildcard like "*.joonas.ninja", which allows any subdomain over http and https
+//   - a full origin like "https://chat.joonas.ninja", which is matched exactly
+//
+// ALLOW_LOCALHOST_ORIGINS=true additionally allows localhost and 127.0.0.1 on any port for development.
+// When ALLOWED_ORIGIN is not set every origin is allowed.
+type originPolicy struct {
+	allowAll       bool
+	allowLocalhost bool
+	origins        []string
+	domains        []string
+	wildcards      []string
+}
+
+func newOriginPolicy(allowedOrigins string, allowLocalhost bool) originPolicy {
+	policy := originPolicy{allowLocalhost: allowLocalhost}
+	for _, entry := range strings.Split(allowedOrigins, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "://") {
+			policy.origins = append(policy.origins, strings.TrimSuffix(entry, "/"))
+		} else if strings.HasPrefix(entry, "*.") {
+			policy.wildcards = append(policy.wildcards, strings.TrimPrefix(entry, "*"))
+		} else {
+			policy.domains = append(policy.domains, entry, "www."+entry)
+		}
+	}
+	return policy
+}
+
+// loadOriginPolicy - Reads the origin policy from the env.
+func loadOriginPolicy() originPolicy {
+	allowedOrigins, found := os.LookupEnv("ALLOWED_ORIGIN")
+	if !found {
+		return originPolicy{allowAll: true}
+	}
+	return newOriginPolicy(allowedOrigins, os.Getenv("ALLOW_LOCALHOST_ORIGINS") == "true")
+}
+
+func (p originPolicy) allows(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	parsed, err := url.Parse(origin)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return false
+	}
+	for _, allowed := range p.origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	host := parsed.Hostname()
+	if p.allowLocalhost && (host == "localhost" || host == "127.0.0.1") {
+		return true
+	}
+	if parsed.Port() != "" {
+		return false
+	}
+	for _, domain := range p.domains {
+		if host == domain {
+			return true
+		}
+	}
+	for _, wildcard := range p.wildcards {
+		if strings.HasSuffix(host, wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin - Requests without an Origin header do not come from a browser page and are let through.
+func checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" || loadOriginPolicy().allows(origin) {
+		return true
+	}
+	log.Print("checkOrigin(): Rejected origin '", origin, "' from ", clientIP(request), " on ", request.URL.Path)
+	return false
+}
+
+// withCORS - Wraps an http endpoint with the origin policy. Answers preflight requests and
+// rejects requests from origins that are not allowed.
+func withCORS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		responseWriter.Header().Add("Vary", "Origin")
+		if !checkOrigin(request) {
+			writeJSONError(responseWriter, http.StatusForbidden, ErrorCodeOriginNotAllowed, "origin not allowed")
+			return
+		}
+		if origin != "" {
+			responseWriter.Header().Set("Access-Control-Allow-Origin", origin)
+			responseWriter.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if request.Method == http.MethodOptions {
+			responseWriter.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			responseWriter.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+csrfHeaderName)
+			responseWriter.Header().Set("Access-Control-Max-Age", "600")
+			responseWriter.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler(responseWriter, request)
+	}
+}
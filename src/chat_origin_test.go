@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginPolicy(t *testing.T) {
+	policy := newOriginPolicy("joonas.ninja, *.example.com,https://chat.other.org", true)
+	allowed := []string{
+		"https://joonas.ninja",
+		"http://www.joonas.ninja",
+		"https://a.example.com",
+		"https://deep.a.example.com",
+		"https://chat.other.org",
+		"http://localhost:3000",
+		"http://127.0.0.1:8080",
+	}
+	rejected := []string{
+		"https://evil.joonas.ninja",
+		"https://joonas.ninja.evil.com",
+		"https://example.com",
+		"https://evilexample.com",
+		"http://chat.other.org",
+		"https://joonas.ninja:8443",
+		"ftp://joonas.ninja",
+		"null",
+	}
+	for _, origin := range allowed {
+		assert.True(t, policy.allows(origin), origin)
+	}
+	for _, origin := range rejected {
+		assert.False(t, policy.allows(origin), origin)
+	}
+	assert.False(t, newOriginPolicy("joonas.ninja", false).allows("http://localhost:3000"))
+}
+
+func TestLoginPreflight(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGIN", "joonas.ninja")
+	defer os.Unsetenv("ALLOWED_ORIGIN")
+	handler := withCORS(loginRequest)
+
+	request := httptest.NewRequest(http.MethodOptions, "/api/v1/http/chat/login", nil)
+	request.Header.Set("Origin", "https://joonas.ninja")
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://joonas.ninja", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Methods"), "POST")
+
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/http/chat/login", strings.NewReader("{}"))
+	request.Header.Set("Origin", "https://evil.com")
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestWebsocketRejectsForeignOrigin(t *testing.T) {
+	os.Setenv("ALLOWED_ORIGIN", "joonas.ninja")
+	defer os.Unsetenv("ALLOWED_ORIGIN")
+	server := httptest.NewServer(http.HandlerFunc(chatRequest))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	_, response, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://evil.com"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxPinsPerChannel - How many messages one channel can have pinned.
+const maxPinsPerChannel = 50
+
+// Pin actions in the pin update event.
+const (
+	PinAdded   = "pin"
+	PinRemoved = "unpin"
+)
+
+// pinnedMessage - A message pinned on a channel, as it was when it was pinned.
+type pinnedMessage struct {
+	Message    EventData `json:"message"`
+	PinnedBy   string    `json:"pinnedBy"`
+	PinnedDate time.Time `json:"pinnedDate"`
+}
+
+type channelPinsDTO struct {
+	CreatorToken string          `json:"creatorToken"`
+	ChannelId    string          `json:"channelId"`
+	Pins         []pinnedMessage `json:"pins"`
+}
+
+// pinUpdateDTO - The body of the pin update event broadcast to the channel.
+type pinUpdateDTO struct {
+	Action string        `json:"action"`
+	Pin    pinnedMessage `json:"pin"`
+}
+
+// pinStore - The pinned messages of the channels, loaded from the backend when a channel is first needed.
+type pinStore struct {
+	mutex    sync.Mutex
+	channels map[string][]pinnedMessage
+	updates  map[string]*sync.Mutex
+}
+
+var channelPins = &pinStore{channels: map[string][]pinnedMessage{}, updates: map[string]*sync.Mutex{}}
+
+// get - The pinned messages of the channel, oldest pin first.
+func (s *pinStore) get(channelId string) []pinnedMessage {
+	s.mutex.Lock()
+	pins, ok := s.channels[channelId]
+	s.mutex.Unlock()
+	if ok {
+		return pins
+	}
+	pins = []pinnedMessage{}
+	res, err := apiRequest("GET", newApiRequestOptions(&apiRequestOptions{queryString: "?channelId=" + url.QueryEscape(channelId)}), "CHAT_PINS_URL", nil)
+	if err != nil {
+		log.Print("pinStore.get():", err)
+		return pins
+	}
+	if err := json.Unmarshal(res, &pins); err != nil {
+		log.Print("pinStore.get():", err)
+		return []pinnedMessage{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[channelId] = pins
+	return pins
+}
+
+// updateLock - Keeps the updates of one channel in order. Other channels and readers do not wait for the backend.
+func (s *pinStore) updateLock(channelId string) *sync.Mutex {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lock, ok := s.updates[channelId]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.updates[channelId] = lock
+	}
+	return lock
+}
+
+// update - Changes the pins of the channel with the function and persists them. Nothing changes if either fails.
+func (s *pinStore) update(user *User, channelId string, updateFn func(pins []pinnedMessage) ([]pinnedMessage, error)) error {
+	lock := s.updateLock(channelId)
+	lock.Lock()
+	defer lock.Unlock()
+	current := s.get(channelId)
+	pins, err := updateFn(append([]pinnedMessage{}, current...))
+	if err != nil {
+		return err
+	}
+	jsonResponse, err := json.Marshal(channelPinsDTO{CreatorToken: user.Token, ChannelId: channelId, Pins: pins})
+	if err != nil {
+		log.Print("pinStore.update():", err)
+		return genericError()
+	}
+	if _, err := apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_PINS_URL", nil); err != nil {
+		log.Print("pinStore.update():", err)
+		return errors.New("error saving the pins")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[channelId] = pins
+	return nil
+}
+
+func broadcastPinUpdate(user *User, action string, pin pinnedMessage) {
+	jsonResponse, err := json.Marshal(pinUpdateDTO{Action: action, Pin: pin})
+	if err != nil {
+		log.Print("broadcastPinUpdate():", err)
+		return
+	}
+	sendEventData(user, EventData{Event: EventPinUpdate, ChannelId: pin.Message.ChannelId, Body: string(jsonResponse), Name: user.Name,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToChannelFilter(pin.Message.ChannelId))
+}
+
+// handlePinCommand - /pin <messageId> pins a message of the current channel. Messages of shadow banned users
+// can not be pinned since only their author has seen them.
+func handlePinCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	message, ok := findChannelMessage(user.CurrentChannelId, params[1])
+	if !ok || isShadowBannedAuthor(message.Name) {
+		return errMessageNotFound
+	}
+	if !isChannelAdmin(user, user.CurrentChannelId) {
+		return replyMustBeChannelAdmin()
+	}
+	pin := pinnedMessage{Message: message, PinnedBy: user.Name, PinnedDate: time.Now()}
+	err := channelPins.update(user, user.CurrentChannelId, func(pins []pinnedMessage) ([]pinnedMessage, error) {
+		for _, pinned := range pins {
+			if pinned.Message.Id == message.Id {
+				return nil, errors.New("that message is already pinned")
+			}
+		}
+		if len(pins) >= maxPinsPerChannel {
+			return nil, errors.New("a channel can have at most " + strconv.Itoa(maxPinsPerChannel) + " pins")
+		}
+		return append(pins, pin), nil
+	})
+	if err != nil {
+		return err
+	}
+	audit(AuditPin, user.Name, message.Name, user.CurrentChannelId, message.Id)
+	broadcastPinUpdate(user, PinAdded, pin)
+	return nil
+}
+
+// handleUnpinCommand - /unpin <messageId>
+func handleUnpinCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	if !isChannelAdmin(user, user.CurrentChannelId) {
+		return replyMustBeChannelAdmin()
+	}
+	var removed pinnedMessage
+	err := channelPins.update(user, user.CurrentChannelId, func(pins []pinnedMessage) ([]pinnedMessage, error) {
+		for i, pinned := range pins {
+			if pinned.Message.Id == params[1] {
+				removed = pinned
+				return append(pins[:i], pins[i+1:]...), nil
+			}
+		}
+		return nil, errors.New("that message is not pinned")
+	})
+	if err != nil {
+		return err
+	}
+	audit(AuditUnpin, user.Name, removed.Message.Name, user.CurrentChannelId, removed.Message.Id)
+	broadcastPinUpdate(user, PinRemoved, removed)
+	return nil
+}
+
+// handlePinsCommand - /pins lists the pinned messages of the current channel.
+func handlePinsCommand(_ []string, user *User) error {
+	var visible []pinnedMessage
+	for _, pin := range channelPins.get(user.CurrentChannelId) {
+		if !user.isIgnoringName(pin.Message.Name) {
+			visible = append(visible, pin)
+		}
+	}
+	jsonResponse, err := json.Marshal(append([]pinnedMessage{}, visible...))
+	if err != nil {
+		log.Print("handlePinsCommand():", err)
+		return genericError()
+	}
+	sendSystemMessage(string(jsonResponse), user, EventPins)
+	return nil
+}
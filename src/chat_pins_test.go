@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinAndUnpin(t *testing.T) {
+	var saves atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			saves.Add(1)
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	history := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":"announcement","event":"message","channelId":"pinchannel","body":"read the rules","name":"boss"}]`)
+	}))
+	os.Setenv("CHAT_PINS_URL", server.URL)
+	os.Setenv("CHAT_HISTORY_URL", history.URL)
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer func() {
+		server.Close()
+		history.Close()
+		os.Unsetenv("CHAT_PINS_URL")
+		os.Unsetenv("CHAT_HISTORY_URL")
+		os.Unsetenv("CHAT_ADMINS")
+		delete(channelPins.channels, "pinchannel")
+	}()
+	message := EventData{Id: newMessageId(), Event: EventMessage, ChannelId: "pinchannel", Body: "read this", Name: "friend", CreatedDate: time.Now()}
+	sentMessages.add(message)
+	boss := &User{Name: "boss", Token: "token", CurrentChannelId: "pinchannel"}
+	other := &User{Name: "other", Token: "token", CurrentChannelId: "pinchannel"}
+
+	assert.Equal(t, replyMustBeChannelAdmin(), handlePinCommand([]string{CommandPin, message.Id}, other))
+	assert.Nil(t, handlePinCommand([]string{CommandPin, message.Id}, boss))
+	assert.NotNil(t, handlePinCommand([]string{CommandPin, message.Id}, boss))
+	pins := channelPins.get("pinchannel")
+	assert.Len(t, pins, 1)
+	assert.Equal(t, "read this", pins[0].Message.Body)
+	assert.Equal(t, "boss", pins[0].PinnedBy)
+
+	assert.NotNil(t, handleUnpinCommand([]string{CommandUnpin, "missing"}, boss))
+	assert.Nil(t, handleUnpinCommand([]string{CommandUnpin, message.Id}, boss))
+	assert.Empty(t, channelPins.get("pinchannel"))
+	assert.Equal(t, int32(2), saves.Load())
+
+	sentMessages.remove("announcement")
+	assert.Nil(t, handlePinCommand([]string{CommandPin, "announcement"}, boss), "Messages that are no longer cached are found from the history.")
+	assert.Equal(t, "read the rules", channelPins.get("pinchannel")[0].Message.Body)
+}
+
+func TestShadowBannedMessagesCanNotBePinned(t *testing.T) {
+	os.Setenv("CHAT_ADMINS", "boss")
+	defer os.Unsetenv("CHAT_ADMINS")
+	shadowBans.addName("hidden")
+	defer shadowBans.removeName("hidden")
+	message := EventData{Id: newMessageId(), Event: EventMessage, ChannelId: "pinchannel", Body: "only I see this", Name: "hidden", CreatedDate: time.Now()}
+	sentMessages.add(message)
+	boss := &User{Name: "boss", Token: "token", CurrentChannelId: "pinchannel"}
+	assert.Equal(t, errMessageNotFound, handlePinCommand([]string{"pin", message.Id}, boss))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The presence states of a user. Idle is set by the server, the others by the user.
+const (
+	PresenceOnline = "online"
+	PresenceAway   = "away"
+	PresenceBusy   = "busy"
+	PresenceIdle   = "idle"
+)
+
+// maxAwayMessageLength - How long the away message can be.
+const maxAwayMessageLength = 100
+
+// presenceState - The presence of a connection. Read by other connections so it has its own mutex.
+type presenceState struct {
+	mutex        sync.Mutex
+	status       string
+	message      string
+	lastActivity time.Time
+}
+
+// presenceDTO - The body of the presence event.
+type presenceDTO struct {
+	Name     string `json:"name"`
+	Presence string `json:"presence"`
+	Message  string `json:"message,omitempty"`
+}
+
+// getPresence - The presence state and the away message of the user.
+func (u *User) getPresence() (string, string) {
+	u.presence.mutex.Lock()
+	defer u.presence.mutex.Unlock()
+	if u.presence.status == "" {
+		return PresenceOnline, ""
+	}
+	return u.presence.status, u.presence.message
+}
+
+// setPresence - Changes the presence of the user. Returns false if nothing changed.
+func (u *User) setPresence(status string, message string) bool {
+	u.presence.mutex.Lock()
+	defer u.presence.mutex.Unlock()
+	if u.presence.status == status && u.presence.message == message {
+		return false
+	}
+	u.presence.status = status
+	u.presence.message = message
+	return true
+}
+
+// idleFor - How long it has been since the user last sent anything.
+func (u *User) idleFor() time.Duration {
+	u.presence.mutex.Lock()
+	defer u.presence.mutex.Unlock()
+	return time.Since(u.presence.lastActivity)
+}
+
+// markActive - Called by the reader for every event the user sends. Brings an idle user back online.
+func (u *User) markActive() {
+	u.presence.mutex.Lock()
+	u.presence.lastActivity = time.Now()
+	wasIdle := u.presence.status == PresenceIdle
+	if wasIdle {
+		u.presence.status = PresenceOnline
+	}
+	u.presence.mutex.Unlock()
+	if wasIdle {
+		broadcastPresence(u)
+	}
+}
+
+// checkIdle - Called by the reader on every pong. Users that are online but have not sent anything in IDLE_AFTER_SECONDS
+// become idle. Users that are away or busy stay that way.
+func (u *User) checkIdle() {
+	idleAfter := time.Duration(getEnvInt("IDLE_AFTER_SECONDS", 300)) * time.Second
+	if idleAfter <= 0 || u.idleFor() < idleAfter {
+		return
+	}
+	if status, _ := u.getPresence(); status == PresenceOnline && u.setPresence(PresenceIdle, "") {
+		broadcastPresence(u)
+	}
+}
+
+// broadcastPresence - Tells everyone on the channel of the user about their new presence.
+func broadcastPresence(user *User) {
+	status, message := user.getPresence()
+	jsonResponse, err := json.Marshal(presenceDTO{Name: user.Name, Presence: status, Message: message})
+	if err != nil {
+		log.Print("broadcastPresence():", err)
+		return
+	}
+	sendEventData(user, EventData{Event: EventPresence, ChannelId: user.CurrentChannelId, Body: string(jsonResponse), Name: user.Name,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToAllOnChannelFilter)
+}
+
+// handleAwayCommand - /away [message]
+func handleAwayCommand(params []string, user *User) error {
+	message := strings.TrimSpace(strings.Join(params[1:], " "))
+	if len(message) > maxAwayMessageLength {
+		return errors.New("that away message is too long")
+	}
+	if user.setPresence(PresenceAway, message) {
+		broadcastPresence(user)
+	}
+	return nil
+}
+
+// handleBusyCommand - /busy
+func handleBusyCommand(_ []string, user *User) error {
+	if user.setPresence(PresenceBusy, "") {
+		broadcastPresence(user)
+	}
+	return nil
+}
+
+// handleBackCommand - /back
+func handleBackCommand(_ []string, user *User) error {
+	if user.setPresence(PresenceOnline, "") {
+		broadcastPresence(user)
+	}
+	return nil
+}
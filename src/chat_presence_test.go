@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleAndActive(t *testing.T) {
+	user := &User{}
+	user.presence.lastActivity = time.Now().Add(-time.Hour)
+	user.checkIdle()
+	status, _ := user.getPresence()
+	assert.Equal(t, PresenceIdle, status)
+	user.markActive()
+	status, _ = user.getPresence()
+	assert.Equal(t, PresenceOnline, status)
+
+	user.setPresence(PresenceBusy, "")
+	user.presence.lastActivity = time.Now().Add(-time.Hour)
+	user.checkIdle()
+	status, _ = user.getPresence()
+	assert.Equal(t, PresenceBusy, status, "Busy users do not become idle.")
+}
+
+func TestAwayIsBroadcastAndShownInWho(t *testing.T) {
+	away, server := testSetup(t)
+	other, otherServer := testSetup(t)
+	defer func() {
+		away.Close()
+		other.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	awayName := readUntil(t, away, EventJoin).Body
+	readUntil(t, other, EventJoin)
+
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "/away lunch time"})
+	assert.Nil(t, away.WriteMessage(websocket.TextMessage, jsonResponse))
+	var presence presenceDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, other, EventPresence).Body), &presence))
+	assert.Equal(t, presenceDTO{Name: awayName, Presence: PresenceAway, Message: "lunch time"}, presence)
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "/who"})
+	assert.Nil(t, other.WriteMessage(websocket.TextMessage, jsonResponse))
+	var who []whoDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, other, EventWho).Body), &who))
+	for _, entry := range who {
+		if entry.Name == awayName {
+			assert.Equal(t, PresenceAway, entry.Presence)
+			assert.Equal(t, "lunch time", entry.Message)
+		}
+	}
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "/whois " + awayName})
+	assert.Nil(t, other.WriteMessage(websocket.TextMessage, jsonResponse))
+	var card whoisDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, other, EventWhois).Body), &card))
+	assert.Equal(t, awayName, card.Name)
+	assert.False(t, card.Registered)
+	assert.Equal(t, RoleMember, card.Role)
+	assert.Equal(t, []string{PublicChannelName}, card.Channels)
+	assert.Nil(t, card.Account)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTrackedKeys - After this many tracked keys the limiter starts pruning expired entries.
+const maxTrackedKeys = 10000
+
+type attemptEntry struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// attemptLimiter - Counts attempts per key inside a time window and locks the key out once the limit is reached.
+type attemptLimiter struct {
+	mutex   sync.Mutex
+	entries map[string]*attemptEntry
+	max     int
+	window  time.Duration
+	lockout time.Duration
+	timeNow func() time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration, lockout time.Duration) *attemptLimiter {
+	return &attemptLimiter{entries: map[string]*attemptEntry{}, max: max, window: window, lockout: lockout, timeNow: time.Now}
+}
+
+// locked - Returns how long the key is still locked out, or false if it is not.
+func (l *attemptLimiter) locked(key string) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0, false
+	}
+	now := l.timeNow()
+	if now.Before(entry.lockedUntil) {
+		return entry.lockedUntil.Sub(now), true
+	}
+	if now.Sub(entry.windowStart) > l.window {
+		delete(l.entries, key)
+	}
+	return 0, false
+}
+
+// add - Records an attempt for the key. Returns true if the key got locked out because of it.
+func (l *attemptLimiter) add(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.timeNow()
+	if len(l.entries) > maxTrackedKeys {
+		l.prune(now)
+	}
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.windowStart) > l.window {
+		entry = &attemptEntry{windowStart: now}
+		l.entries[key] = entry
+	}
+	entry.count++
+	if entry.count >= l.max {
+		entry.count = 0
+		entry.windowStart = now
+		entry.lockedUntil = now.Add(l.lockout)
+		return true
+	}
+	return false
+}
+
+// reset - Forgets everything about the key.
+func (l *attemptLimiter) reset(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.entries, key)
+}
+
+func (l *attemptLimiter) prune(now time.Time) {
+	for key, entry := range l.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.windowStart) > l.window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// tokenBucket - Allows bursts up to the capacity and refills at a steady rate after that.
+type tokenBucket struct {
+	mutex           sync.Mutex
+	tokens          float64
+	capacity        float64
+	refillPerSecond float64
+	last            time.Time
+	timeNow         func() time.Time
+}
+
+func newTokenBucket(capacity float64, refillPerSecond float64) *tokenBucket {
+	return &tokenBucket{tokens: capacity, capacity: capacity, refillPerSecond: refillPerSecond, last: time.Now(), timeNow: time.Now}
+}
+
+// take - Takes one token from the bucket. Returns false if the bucket is empty.
+func (b *tokenBucket) take() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.timeNow()
+	b.tokens += now.Sub(b.last).Seconds() * b.refillPerSecond
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEmojiLength - Reactions longer than this many characters are not emoji.
+const maxEmojiLength = 32
+
+// maxDistinctReactions - How many different reactions one message can have.
+const maxDistinctReactions = 20
+
+// Reaction actions sent by the client.
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+// reactionDTO - The body of a reaction event sent by the client.
+type reactionDTO struct {
+	MessageId string `json:"messageId"`
+	Emoji     string `json:"emoji"`
+	Action    string `json:"action"`
+}
+
+// reactionCount - How many users reacted to a message with an emoji, and who. Users are listed by account name
+// so that a new nick does not give anyone more reactions.
+type reactionCount struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// reactionUpdate - The body of the reaction event broadcast to the channel. Contains all the reactions of the message.
+type reactionUpdate struct {
+	MessageId string          `json:"messageId"`
+	Reactions []reactionCount `json:"reactions"`
+}
+
+// reactionHistoryDTO - A single reaction change sent to the backend.
+type reactionHistoryDTO struct {
+	MessageId string `json:"messageId"`
+	ChannelId string `json:"channelId"`
+	Emoji     string `json:"emoji"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+}
+
+// updateReactionHistory - Sends the reaction change to the backend so that it is part of the history.
+func updateReactionHistory(change reactionHistoryDTO) {
+	jsonResponse, err := json.Marshal(change)
+	if err != nil {
+		log.Print("updateReactionHistory():", err)
+		return
+	}
+	go apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_REACTION_URL", nil)
+}
+
+func copyReactions(reactions []reactionCount) []reactionCount {
+	copied := make([]reactionCount, len(reactions))
+	for i, reaction := range reactions {
+		copied[i] = reaction
+		copied[i].Users = append([]string{}, reaction.Users...)
+	}
+	return copied
+}
+
+func validEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+	return strings.IndexFunc(emoji, unicode.IsSpace) == -1
+}
+
+// addReaction - Adds the reaction of the user to the message. A user can have MAX_REACTIONS_PER_USER different
+// reactions on one message.
+func addReaction(message *EventData, emoji string, name string) error {
+	var userReactions int
+	index := -1
+	for i, reaction := range message.Reactions {
+		for _, user := range reaction.Users {
+			if user == name {
+				if reaction.Emoji == emoji {
+					return errors.New("you have already reacted with that")
+				}
+				userReactions++
+			}
+		}
+		if reaction.Emoji == emoji {
+			index = i
+		}
+	}
+	if userReactions >= getEnvInt("MAX_REACTIONS_PER_USER", 3) {
+		return errors.New("you have reacted to that message too many times")
+	}
+	if index == -1 {
+		if len(message.Reactions) >= maxDistinctReactions {
+			return errors.New("that message has too many different reactions")
+		}
+		message.Reactions = append(message.Reactions, reactionCount{Emoji: emoji})
+		index = len(message.Reactions) - 1
+	}
+	message.Reactions[index].Users = append(message.Reactions[index].Users, name)
+	message.Reactions[index].Count = len(message.Reactions[index].Users)
+	return nil
+}
+
+// removeReaction - Removes the reaction of the user from the message. Emoji nobody reacts with anymore are dropped.
+func removeReaction(message *EventData, emoji string, name string) error {
+	for i, reaction := range message.Reactions {
+		if reaction.Emoji != emoji {
+			continue
+		}
+		for j, user := range reaction.Users {
+			if user == name {
+				users := append(append([]string{}, reaction.Users[:j]...), reaction.Users[j+1:]...)
+				if len(users) == 0 {
+					message.Reactions = append(append([]reactionCount{}, message.Reactions[:i]...), message.Reactions[i+1:]...)
+				} else {
+					message.Reactions[i].Users = users
+					message.Reactions[i].Count = len(users)
+				}
+				return nil
+			}
+		}
+	}
+	return errors.New("you have not reacted with that")
+}
+
+// handleReactionEvent - Adds or removes a reaction on a message in the current channel and broadcasts
+// the new reaction counts of the message to the channel.
+func handleReactionEvent(event EventData, user *User) {
+	var reaction reactionDTO
+	if err := json.Unmarshal([]byte(event.Body), &reaction); err != nil {
+		sendSystemMessage("Malformed reaction.", user, EventErrorNotification)
+		return
+	}
+	if !validEmoji(reaction.Emoji) || (reaction.Action != ReactionAdd && reaction.Action != ReactionRemove) {
+		sendSystemMessage("Malformed reaction.", user, EventErrorNotification)
+		return
+	}
+	if message, ok := sentMessages.get(reaction.MessageId); !ok || message.ChannelId != user.CurrentChannelId {
+		sendSystemMessage(errMessageNotFound.Error(), user, EventErrorNotification)
+		return
+	}
+	if user.messageBucket != nil && !user.messageBucket.take() {
+		sendSystemMessage("You are reacting too fast. Slow down.", user, EventErrorNotification)
+		return
+	}
+	updateFn := func(message *EventData) error {
+		message.Reactions = copyReactions(message.Reactions)
+		if reaction.Action == ReactionAdd {
+			return addReaction(message, reaction.Emoji, user.accountName())
+		}
+		return removeReaction(message, reaction.Emoji, user.accountName())
+	}
+	var message EventData
+	var err error
+	if user.isShadowBanned() {
+		// Shadow banned users see their reaction but it is not stored. The delivery filter keeps it from everyone else.
+		message, _ = sentMessages.get(reaction.MessageId)
+		err = updateFn(&message)
+	} else {
+		message, err = sentMessages.update(reaction.MessageId, updateFn)
+	}
+	if err != nil {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return
+	}
+	if !user.isShadowBanned() {
+		updateReactionHistory(reactionHistoryDTO{MessageId: message.Id, ChannelId: message.ChannelId, Emoji: reaction.Emoji, Name: user.accountName(), Action: reaction.Action})
+	}
+	jsonUpdate, err := json.Marshal(reactionUpdate{MessageId: message.Id, Reactions: message.Reactions})
+	if err != nil {
+		log.Print("handleReactionEvent():", err)
+		return
+	}
+	sendEventData(user, EventData{Event: EventReaction, ChannelId: message.ChannelId, Body: string(jsonUpdate), Name: user.Name,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToAllOnChannelFilter)
+}
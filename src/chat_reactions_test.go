@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAndRemoveReactions(t *testing.T) {
+	message := &EventData{Id: "m1"}
+	assert.Nil(t, addReaction(message, "👍", "alice"))
+	assert.Nil(t, addReaction(message, "👍", "bob"))
+	assert.Nil(t, addReaction(message, "🎉", "alice"))
+	assert.NotNil(t, addReaction(message, "👍", "alice"), "The same reaction can not be added twice.")
+	assert.Equal(t, []reactionCount{{Emoji: "👍", Count: 2, Users: []string{"alice", "bob"}}, {Emoji: "🎉", Count: 1, Users: []string{"alice"}}}, message.Reactions)
+
+	assert.Nil(t, addReaction(message, "🔥", "alice"))
+	assert.NotNil(t, addReaction(message, "💯", "alice"), "A user can only have three reactions on a message.")
+
+	assert.Nil(t, removeReaction(message, "🎉", "alice"))
+	assert.NotNil(t, removeReaction(message, "🎉", "alice"))
+	assert.Nil(t, removeReaction(message, "👍", "bob"))
+	assert.Equal(t, []reactionCount{{Emoji: "👍", Count: 1, Users: []string{"alice"}}, {Emoji: "🔥", Count: 1, Users: []string{"alice"}}}, message.Reactions)
+	assert.False(t, validEmoji("not an emoji"))
+}
+
+func TestReactionIsBroadcastWithCounts(t *testing.T) {
+	// The backend does not know about the reaction yet. Late joiners get it from the cached message.
+	var historyId atomic.Value
+	historyId.Store("")
+	history := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := historyId.Load().(string); id != "" {
+			fmt.Fprintf(w, `[{"id":%q,"event":"message","body":"react to this"}]`, id)
+			return
+		}
+		fmt.Fprint(w, "[]")
+	}))
+	os.Setenv("CHAT_HISTORY_URL", history.URL)
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+		history.Close()
+		os.Unsetenv("CHAT_HISTORY_URL")
+	}()
+	readUntil(t, ws, EventJoin)
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "react to this"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, ws, EventMessage)
+	assert.NotEmpty(t, message.Id)
+
+	reaction, _ := json.Marshal(reactionDTO{MessageId: message.Id, Emoji: "👍", Action: ReactionAdd})
+	jsonResponse, _ = json.Marshal(EventData{Event: EventReaction, Body: string(reaction)})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	var update reactionUpdate
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, ws, EventReaction).Body), &update))
+	assert.Equal(t, message.Id, update.MessageId)
+	assert.Equal(t, 1, update.Reactions[0].Count)
+
+	historyId.Store(message.Id)
+	lateJoiner, otherServer := testSetup(t)
+	defer func() {
+		otherServer.Close()
+		lateJoiner.Close()
+	}()
+	_, payload, err := lateJoiner.ReadMessage()
+	assert.Nil(t, err)
+	var joinHistory ChatHistory
+	assert.Nil(t, json.Unmarshal(payload, &joinHistory))
+	assert.Equal(t, EventChatHistory, joinHistory.Event)
+	if assert.Len(t, joinHistory.Body, 1) {
+		assert.Equal(t, update.Reactions, joinHistory.Body[0].Reactions, "Late joiners get the reactions with the history.")
+	}
+}
+
+func TestNewNickDoesNotGiveMoreReactions(t *testing.T) {
+	nicknameServer := setupServer("CHAT_CHECK_NICKNAME")
+	ws, server := testSetup(t)
+	defer func() {
+		nicknameServer.Close()
+		server.Close()
+		ws.Close()
+	}()
+	readUntil(t, ws, EventJoin)
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "react to this twice"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, ws, EventMessage)
+	reaction, _ := json.Marshal(reactionDTO{MessageId: message.Id, Emoji: "👍", Action: ReactionAdd})
+	reactionEvent, _ := json.Marshal(EventData{Event: EventReaction, Body: string(reaction)})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, reactionEvent))
+	readUntil(t, ws, EventReaction)
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "/nick SomebodyNew"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	readUntil(t, ws, EventNameChange)
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, reactionEvent))
+	assert.Equal(t, "you have already reacted with that", readUntil(t, ws, EventErrorNotification).Body)
+}
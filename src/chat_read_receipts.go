@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// readPosition - The latest message a user has seen on a channel.
+type readPosition struct {
+	ChannelId   string    `json:"channelId"`
+	MessageId   string    `json:"messageId"`
+	CreatedDate time.Time `json:"createdDate"`
+	Unread      int       `json:"unread"`
+}
+
+type readPositionDTO struct {
+	CreatorToken string `json:"creatorToken"`
+	ChannelId    string `json:"channelId,omitempty"`
+	MessageId    string `json:"messageId,omitempty"`
+}
+
+// readReceiptDTO - The body of the read receipt event broadcast to small channels.
+type readReceiptDTO struct {
+	Name      string `json:"name"`
+	MessageId string `json:"messageId"`
+}
+
+// setReadPosition - Moves the read position of the user on the channel of the message forward. Returns false if the
+// user has already read past the message.
+func (u *User) setReadPosition(message EventData) bool {
+	u.readMutex.Lock()
+	defer u.readMutex.Unlock()
+	if u.lastRead == nil {
+		u.lastRead = map[string]readPosition{}
+	}
+	if current, ok := u.lastRead[message.ChannelId]; ok && !message.CreatedDate.After(current.CreatedDate) {
+		return false
+	}
+	u.lastRead[message.ChannelId] = readPosition{ChannelId: message.ChannelId, MessageId: message.Id, CreatedDate: message.CreatedDate}
+	return true
+}
+
+// saveReadPosition - Persists the read position of a logged in user. Guests only keep theirs as long as the connection.
+func saveReadPosition(user *User, message EventData) {
+	if user.isGuest() {
+		return
+	}
+	jsonResponse, _ := json.Marshal(readPositionDTO{CreatorToken: user.Token, ChannelId: message.ChannelId, MessageId: message.Id})
+	go apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_READ_URL", nil)
+}
+
+// getUnreadCounts - How many messages the user has not read on each of their channels, by channel id.
+func getUnreadCounts(user *User) (map[string]int, error) {
+	jsonResponse, _ := json.Marshal(readPositionDTO{CreatorToken: user.Token})
+	res, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_READ_LIST_URL", nil)
+	if err != nil {
+		return nil, err
+	}
+	var positions []readPosition
+	if err := json.Unmarshal(res, &positions); err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, position := range positions {
+		counts[position.ChannelId] = position.Unread
+	}
+	return counts, nil
+}
+
+// withUnreadCounts - Adds the unread count of the user to every channel in the channel list from the backend.
+// The list is returned as it was if the counts can not be added.
+func withUnreadCounts(channelList []byte, user *User) []byte {
+	var channels []map[string]interface{}
+	if err := json.Unmarshal(channelList, &channels); err != nil {
+		log.Print("withUnreadCounts():", err)
+		return channelList
+	}
+	counts, err := getUnreadCounts(user)
+	if err != nil {
+		log.Print("withUnreadCounts():", err)
+		return channelList
+	}
+	for _, channel := range channels {
+		if name, ok := channel["name"].(string); ok {
+			channel["unread"] = counts[name]
+		}
+	}
+	jsonResponse, err := json.Marshal(channels)
+	if err != nil {
+		log.Print("withUnreadCounts():", err)
+		return channelList
+	}
+	return jsonResponse
+}
+
+// channelUserCount - How many users are on the channel right now.
+func channelUserCount(channelId string) int {
+	var count int
+	Users.Range(func(key, value interface{}) bool {
+		if value.(*User).CurrentChannelId == channelId {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// handleReadEvent - Marks everything up to the message as read on the current channel. The body of the event is the
+// id of the message. Channels with at most READ_RECEIPT_MAX_USERS users on them see a read receipt. 0 turns them off.
+func handleReadEvent(event EventData, user *User) {
+	message, ok := sentMessages.get(event.Body)
+	if !ok || message.ChannelId != user.CurrentChannelId {
+		sendSystemMessage(errMessageNotFound.Error(), user, EventErrorNotification)
+		return
+	}
+	if !user.setReadPosition(message) {
+		return
+	}
+	saveReadPosition(user, message)
+	maxUsers := getEnvInt("READ_RECEIPT_MAX_USERS", 10)
+	if maxUsers <= 0 || channelUserCount(user.CurrentChannelId) > maxUsers {
+		return
+	}
+	jsonReceipt, err := json.Marshal(readReceiptDTO{Name: user.Name, MessageId: message.Id})
+	if err != nil {
+		log.Print("handleReadEvent():", err)
+		return
+	}
+	sendEventData(user, EventData{Event: EventReadReceipt, ChannelId: user.CurrentChannelId, Body: string(jsonReceipt), Name: user.Name,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToOtherOnChannelFilter)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPositionOnlyMovesForward(t *testing.T) {
+	user := &User{}
+	now := time.Now()
+	assert.True(t, user.setReadPosition(EventData{Id: "m2", ChannelId: "c", CreatedDate: now}))
+	assert.False(t, user.setReadPosition(EventData{Id: "m1", ChannelId: "c", CreatedDate: now.Add(-time.Second)}))
+	assert.True(t, user.setReadPosition(EventData{Id: "m1", ChannelId: "other", CreatedDate: now.Add(-time.Second)}))
+	assert.Equal(t, "m2", user.lastRead["c"].MessageId)
+}
+
+func TestChannelListHasUnreadCounts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"channelId":"games","messageId":"m1","unread":4}]`)
+	}))
+	os.Setenv("CHAT_READ_LIST_URL", server.URL)
+	defer func() {
+		server.Close()
+		os.Unsetenv("CHAT_READ_LIST_URL")
+	}()
+	var channels []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(withUnreadCounts([]byte(`[{"name":"games","private":false},{"name":"music"}]`), &User{Token: "token"}), &channels))
+	assert.Equal(t, float64(4), channels[0]["unread"])
+	assert.Equal(t, float64(0), channels[1]["unread"])
+	assert.Equal(t, "not a list", string(withUnreadCounts([]byte("not a list"), &User{Token: "token"})))
+}
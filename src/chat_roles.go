@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+)
+
+// isAdmin - Chat wide admins are the accounts listed in CHAT_ADMINS, separated by commas. The nick does not count.
+func isAdmin(user *User) bool {
+	if user.isGuest() {
+		return false
+	}
+	for _, name := range strings.Split(os.Getenv("CHAT_ADMINS"), ",") {
+		if strings.TrimSpace(name) == user.accountName() {
+			return true
+		}
+	}
+	return false
+}
+
+// readChannel - Fetches a channel from the backend. Only works for channels the user has access to.
+func readChannel(user *User, channelId string) (channelReadResponse, error) {
+	var readResponse channelReadResponse
+	jsonResponse, err := json.Marshal(channelGenericDTO{CreatorToken: user.Token, ChannelId: channelId})
+	if err != nil {
+		log.Print("readChannel():", err)
+		return readResponse, genericError()
+	}
+	channelResponse, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_CHANNEL_LIST_URL", nil)
+	if err != nil {
+		return readResponse, err
+	}
+	if err := json.Unmarshal(channelResponse, &readResponse); err != nil {
+		log.Print("readChannel():", err)
+		return readResponse, genericError()
+	}
+	return readResponse, nil
+}
+
+// isChannelAdmin - Admins rule every channel. Otherwise the admin of a channel is the account the backend says it is.
+// The public channel has no admin of its own.
+func isChannelAdmin(user *User, channelId string) bool {
+	if isAdmin(user) {
+		return true
+	}
+	if user.isGuest() || channelId == "" {
+		return false
+	}
+	channel, err := readChannel(user, channelId)
+	if err != nil {
+		log.Print("isChannelAdmin():", err)
+		return false
+	}
+	return channel.Admin == user.accountName()
+}
+
+func replyMustBeChannelAdmin() error {
+	return errors.New("only the channel admin can do that")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSeenRecords - How many users are remembered in memory. The least recently active ones are forgotten first.
+const maxSeenRecords = 10000
+
+// seenSaveInterval - How often the record of a registered user is saved while they are chatting. It is always saved
+// when they disconnect.
+const seenSaveInterval = time.Minute
+
+// seenRecord - When a user was last heard of.
+type seenRecord struct {
+	Name           string    `json:"name"`
+	LastMessage    time.Time `json:"lastMessage"`
+	LastChannel    string    `json:"lastChannel"`
+	LastDisconnect time.Time `json:"lastDisconnect"`
+	registered     bool
+	savedAt        time.Time
+}
+
+// seenDTO - The body of the seen event.
+type seenDTO struct {
+	Name           string     `json:"name"`
+	Online         bool       `json:"online"`
+	LastMessage    *time.Time `json:"lastMessage,omitempty"`
+	LastChannel    string     `json:"lastChannel,omitempty"`
+	LastDisconnect *time.Time `json:"lastDisconnect,omitempty"`
+}
+
+var seenMutex sync.Mutex
+
+// seenRecords - The records by lower case name.
+var seenRecords = map[string]*seenRecord{}
+
+func (r *seenRecord) lastActivity() time.Time {
+	if r.LastMessage.After(r.LastDisconnect) {
+		return r.LastMessage
+	}
+	return r.LastDisconnect
+}
+
+// seenRecordOf - The record of the user. Must be called with the seenMutex held.
+func seenRecordOf(user *User) *seenRecord {
+	key := strings.ToLower(user.Name)
+	record, ok := seenRecords[key]
+	if !ok {
+		if len(seenRecords) >= maxSeenRecords {
+			forgetOldestSeenRecord()
+		}
+		record = &seenRecord{}
+		seenRecords[key] = record
+	}
+	record.Name = user.Name
+	record.registered = !user.isGuest()
+	return record
+}
+
+func forgetOldestSeenRecord() {
+	var oldestKey string
+	var oldest time.Time
+	for key, record := range seenRecords {
+		if oldestKey == "" || record.lastActivity().Before(oldest) {
+			oldestKey = key
+			oldest = record.lastActivity()
+		}
+	}
+	delete(seenRecords, oldestKey)
+}
+
+// saveSeenRecord - Persists the record of a registered user.
+func saveSeenRecord(record seenRecord) {
+	jsonResponse, err := json.Marshal(record)
+	if err != nil {
+		log.Print("saveSeenRecord():", err)
+		return
+	}
+	go apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_SEEN_URL", nil)
+}
+
+// recordMessage - Called for every chat message. Messages of shadow banned users are not recorded.
+func recordMessage(user *User, channelId string) {
+	if user.isShadowBanned() {
+		return
+	}
+	seenMutex.Lock()
+	record := seenRecordOf(user)
+	record.LastMessage = time.Now()
+	record.LastChannel = channelId
+	save := record.registered && time.Since(record.savedAt) >= seenSaveInterval
+	if save {
+		record.savedAt = time.Now()
+	}
+	saved := *record
+	seenMutex.Unlock()
+	if save {
+		saveSeenRecord(saved)
+	}
+}
+
+// recordDisconnect - Called when a connection of the user closes.
+func recordDisconnect(user *User) {
+	seenMutex.Lock()
+	record := seenRecordOf(user)
+	record.LastDisconnect = time.Now()
+	record.savedAt = time.Now()
+	saved := *record
+	seenMutex.Unlock()
+	if saved.registered {
+		saveSeenRecord(saved)
+	}
+}
+
+// getSeenRecord - The record of the named user from memory, or from the backend for registered users that have not
+// been around since the server started.
+func getSeenRecord(name string) (seenRecord, bool) {
+	seenMutex.Lock()
+	record, ok := seenRecords[strings.ToLower(name)]
+	if ok {
+		found := *record
+		seenMutex.Unlock()
+		return found, true
+	}
+	seenMutex.Unlock()
+	res, err := apiRequest("GET", newApiRequestOptions(&apiRequestOptions{queryString: "?name=" + url.QueryEscape(name)}), "CHAT_SEEN_URL", nil)
+	if err != nil {
+		return seenRecord{}, false
+	}
+	var found seenRecord
+	if err := json.Unmarshal(res, &found); err != nil || found.Name == "" {
+		return seenRecord{}, false
+	}
+	return found, true
+}
+
+// visibleChannel - The name of the channel as the asker may see it. Private channels are not shown.
+func visibleChannel(asker *User, channelId string) (string, bool) {
+	if channelId == "" {
+		return PublicChannelName, true
+	}
+	if asker.isGuest() {
+		return "", false
+	}
+	channel, err := readChannel(asker, channelId)
+	if err != nil || channel.Private {
+		return "", false
+	}
+	return channelId, true
+}
+
+// handleSeenCommand - /seen <nick> tells when the user last sent a message and where, and when they last left.
+func handleSeenCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	response := seenDTO{Name: params[1], Online: findUserByName(params[1]) != nil}
+	record, ok := getSeenRecord(params[1])
+	if !ok && !response.Online {
+		return errors.New("nobody called " + params[1] + " has been seen")
+	}
+	if ok {
+		response.Name = record.Name
+		if !record.LastMessage.IsZero() {
+			response.LastMessage = &record.LastMessage
+			response.LastChannel, _ = visibleChannel(user, record.LastChannel)
+		}
+		if !record.LastDisconnect.IsZero() {
+			response.LastDisconnect = &record.LastDisconnect
+		}
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		log.Print("handleSeenCommand():", err)
+		return genericError()
+	}
+	sendSystemMessage(string(jsonResponse), user, EventSeen)
+	return nil
+}
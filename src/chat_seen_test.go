@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenAfterMessageAndDisconnect(t *testing.T) {
+	seen, server := testSetup(t)
+	asker, otherServer := testSetup(t)
+	defer func() {
+		asker.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	seenName := readUntil(t, seen, EventJoin).Body
+	readUntil(t, asker, EventJoin)
+
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "hello"})
+	assert.Nil(t, seen.WriteMessage(websocket.TextMessage, jsonResponse))
+	readUntil(t, seen, EventMessage)
+	seen.Close()
+	readUntilBody(t, asker, EventNotification, seenName+" has disconnected.")
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "/seen " + seenName})
+	assert.Nil(t, asker.WriteMessage(websocket.TextMessage, jsonResponse))
+	var response seenDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, asker, EventSeen).Body), &response))
+	assert.False(t, response.Online)
+	assert.NotNil(t, response.LastMessage)
+	assert.NotNil(t, response.LastDisconnect)
+	assert.Equal(t, PublicChannelName, response.LastChannel)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// shadowBans - Users and addresses whose messages are only shown to themselves.
+var shadowBans = newBanList("CHAT_SHADOW_BAN_URL")
+
+func initShadowBans() {
+	shadowBans.load()
+	log.Print("initShadowBans():", "Shadow bans loaded.")
+}
+
+// isShadowBanned - Whether the messages of the user are hidden from everyone else.
+func (u *User) isShadowBanned() bool {
+	return u.shadowBanned.Load()
+}
+
+// applyShadowBan - Marks a connecting user as shadow banned if their name or address is on the list.
+// Guest names are random so only their address is checked.
+func applyShadowBan(user *User) {
+	if (!user.isGuest() && shadowBans.hasName(user.Name)) || shadowBans.hasIP(user.IP) {
+		user.shadowBanned.Store(true)
+		log.Print("applyShadowBan(): ", user.Name, " is shadow banned.")
+	}
+}
+
+// isShadowBannedAuthor - Whether the author of a message is shadow banned by name or through their connection.
+func isShadowBannedAuthor(name string) bool {
+	if shadowBans.hasName(name) {
+		return true
+	}
+	author := findUserByName(name)
+	return author != nil && author.isShadowBanned()
+}
+
+// carryShadowBan - Moves a name ban to the new name of the user so that changing the nick is no way out of it.
+func carryShadowBan(user *User, oldName string) {
+	if user.isGuest() || !shadowBans.removeName(oldName) {
+		return
+	}
+	shadowBans.addName(user.Name)
+	log.Print("carryShadowBan(): ", oldName, " is now called ", user.Name, ". The shadow ban follows.")
+	if err := shadowBans.save(); err != nil {
+		log.Print("carryShadowBan():", err)
+	}
+}
+
+func saveShadowBans(admin *User) {
+	if err := shadowBans.save(); err != nil {
+		log.Print("saveShadowBans():", err)
+		sendSystemMessage("The shadow ban list could not be saved. The change is lost when the server restarts.", admin, EventErrorNotification)
+	}
+}
+
+// setShadowBannedOnline - Updates the users that are connected right now.
+func setShadowBannedOnline() {
+	Users.Range(func(key, value interface{}) bool {
+		user := value.(*User)
+		user.shadowBanned.Store((!user.isGuest() && shadowBans.hasName(user.Name)) || shadowBans.hasIP(user.IP))
+		return true
+	})
+}
+
+// handleShadowBanCommand - /shadowban <nick>, /shadowban ip <address or range> or /shadowban list.
+// Logged in users are banned by name. Guests by their address since their names change on every connect.
+func handleShadowBanCommand(params []string, user *User) error {
+	if !isAdmin(user) {
+		return errors.New("only admins can do that")
+	}
+	if len(params) == 2 && params[1] == "list" {
+		jsonResponse, err := json.Marshal(shadowBans.list())
+		if err != nil {
+			log.Print("handleShadowBanCommand():", err)
+			return genericError()
+		}
+		sendSystemMessage(string(jsonResponse), user, EventShadowBanList)
+		return nil
+	}
+	if len(params) == 3 && params[1] == "ip" {
+		if err := shadowBans.addIP(params[2]); err != nil {
+			return err
+		}
+		audit(AuditShadowBan, user.Name, params[2], "", "ip")
+		sendSystemMessage("Address "+params[2]+" is now shadow banned.", user, EventNotification)
+	} else if len(params) == 2 {
+		target := findUserByName(params[1])
+		if target == user {
+			return errors.New("you can not shadow ban yourself")
+		}
+		if target != nil && target.isGuest() {
+			if err := shadowBans.addIP(target.IP); err != nil {
+				return err
+			}
+			audit(AuditShadowBan, user.Name, target.Name, target.CurrentChannelId, "ip "+target.IP)
+		} else {
+			shadowBans.addName(params[1])
+			audit(AuditShadowBan, user.Name, params[1], "", "name")
+		}
+		sendSystemMessage(params[1]+" is now shadow banned.", user, EventNotification)
+	} else {
+		return notEnoughParameters()
+	}
+	setShadowBannedOnline()
+	saveShadowBans(user)
+	return nil
+}
+
+// handleUnshadowBanCommand - /unshadowban <nick> or /unshadowban ip <address or range>.
+func handleUnshadowBanCommand(params []string, user *User) error {
+	if !isAdmin(user) {
+		return errors.New("only admins can do that")
+	}
+	if len(params) == 3 && params[1] == "ip" {
+		if !shadowBans.removeIP(params[2]) {
+			return errors.New("that address is not shadow banned")
+		}
+		audit(AuditUnshadowBan, user.Name, params[2], "", "ip")
+	} else if len(params) == 2 {
+		removed := shadowBans.removeName(params[1])
+		if target := findUserByName(params[1]); target != nil && target.isGuest() {
+			removed = shadowBans.removeIP(target.IP) || removed
+		}
+		if !removed {
+			return errors.New(params[1] + " is not shadow banned")
+		}
+		audit(AuditUnshadowBan, user.Name, params[1], "", "")
+	} else {
+		return notEnoughParameters()
+	}
+	setShadowBannedOnline()
+	saveShadowBans(user)
+	sendSystemMessage(params[len(params)-1]+" is no longer shadow banned.", user, EventNotification)
+	return nil
+}
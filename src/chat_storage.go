@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// fileStorage - Where uploaded files are kept. Keys are generated by the chat and never come from the user as is.
+type fileStorage interface {
+	save(key string, content io.Reader) error
+	open(key string) (io.ReadCloser, error)
+	remove(key string) error
+	list() ([]string, error)
+}
+
+// storageKeyPattern - What storage keys look like. Keeps keys from escaping the storage.
+var storageKeyPattern = regexp.MustCompile(`^[a-f0-9]+(\.[a-z]+)?$`)
+
+var errInvalidStorageKey = errors.New("invalid storage key")
+
+// localStorage - Keeps the files in a directory on the local disk.
+type localStorage struct {
+	dir string
+}
+
+func newLocalStorage(dir string) *localStorage {
+	return &localStorage{dir: dir}
+}
+
+func (s *localStorage) path(key string) (string, error) {
+	if !storageKeyPattern.MatchString(key) {
+		return "", errInvalidStorageKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// save - Writes the file to a temporary file first so that a failed upload never leaves half a file behind.
+func (s *localStorage) save(key string, content io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *localStorage) open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *localStorage) remove(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// list - The keys of everything in the storage.
+func (s *localStorage) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		if !entry.IsDir() && storageKeyPattern.MatchString(entry.Name()) {
+			keys = append(keys, entry.Name())
+		}
+	}
+	return keys, nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +20,8 @@ func chatHistoryTest(w http.ResponseWriter, r *http.Request) {
 }
 
 func testSetup(t *testing.T) (*websocket.Conn, *httptest.Server) {
+	// Every test connects from the same address.
+	connectionRateLimiter = newAttemptLimiter(1000, time.Minute, time.Minute)
 	server := httptest.NewServer(http.HandlerFunc(chatRequest))
 	url := "ws" + strings.TrimPrefix(server.URL, "http")
 	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
@@ -118,8 +121,29 @@ func TestErrorWhenMessageTooLong(t *testing.T) {
 	jsonResponse, err := json.Marshal(testRequest)
 	assert.Nil(t, err)
 	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
-	_, _, err = ws.ReadMessage()
-	assert.Equal(t, true, err != nil && err.Error() == "websocket: close 1009 (message too big)")
+	assert.Equal(t, "Your message is too long. The limit is 512 bytes. Send long text in parts.", readUntil(t, ws, EventErrorNotification).Body,
+		"Messages over the limit are rejected without closing the connection.")
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "still here"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	assert.Equal(t, "still here", readUntil(t, ws, EventMessage).Body)
+}
+
+func TestMessageSentInParts(t *testing.T) {
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	readUntil(t, ws, EventJoin)
+	logLine := strings.Repeat("x", 400) + "\n"
+	for index := 0; index < 3; index++ {
+		part, _ := json.Marshal(messagePartDTO{Id: "log", Index: index, Total: 3, Body: logLine})
+		jsonResponse, _ := json.Marshal(EventData{Event: EventMessagePart, Body: string(part), Format: FormatCode})
+		assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	}
+	message := readUntil(t, ws, EventMessage)
+	assert.Equal(t, strings.Repeat(logLine, 3), message.Body)
+	assert.Equal(t, FormatCode, message.Format)
 }
 
 func TestChangeName(t *testing.T) {
@@ -147,4 +171,168 @@ func TestChangeName(t *testing.T) {
 		responseData.UserCount == 1 &&
 		responseData.Event == EventNameChange,
 		"nameChange-event should return the user set name in the response and the response structure should be as expected.")
-}
\ No newline at end of file
+}
+
+func TestGuestsDisabled(t *testing.T) {
+	os.Setenv("GUESTS_ENABLED", "false")
+	defer os.Unsetenv("GUESTS_ENABLED")
+	var responseData EventData
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	_, message, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(message, &responseData))
+	assert.Equal(t, EventErrorNotification, responseData.Event)
+	_, _, err = ws.ReadMessage()
+	assert.NotNil(t, err, "The connection should be closed after the guest is rejected.")
+}
+
+func TestReadOnlyGuestCannotSendMessages(t *testing.T) {
+	os.Setenv("GUESTS_READ_ONLY", "true")
+	defer os.Unsetenv("GUESTS_READ_ONLY")
+	var responseData EventData
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	_, _, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	_, _, err = ws.ReadMessage()
+	assert.Nil(t, err)
+	jsonResponse, err := json.Marshal(EventData{Event: EventMessage, Body: "Testing message"})
+	assert.Nil(t, err)
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	_, message, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(message, &responseData))
+	assert.Equal(t, EventErrorNotification, responseData.Event)
+}
+
+func TestGuestNames(t *testing.T) {
+	policy := loadGuestPolicy()
+	name := policy.newGuestName()
+	assert.True(t, strings.HasPrefix(name, "Anon") && len(name) > len("Anon"))
+	policy.namePrefix = ""
+	policy.reservedNames = append(policy.reservedNames, "QuietOtter")
+	for i := 0; i < 100; i++ {
+		assert.NotEqual(t, "QuietOtter", policy.newGuestName())
+	}
+}
+
+func TestGuestPolicyAppliesToCommands(t *testing.T) {
+	testServer := setupServer("CHAT_CHECK_NICKNAME")
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+		testServer.Close()
+	}()
+	for command, expected := range map[string]string{"/nick Admin": "that name is reserved", "/channel join secret": replyMustBeLoggedIn().Error()} {
+		jsonResponse, err := json.Marshal(EventData{Event: EventMessage, Body: command})
+		assert.Nil(t, err)
+		assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+		responseData := readUntilBody(t, ws, EventErrorNotification, expected)
+		assert.Equal(t, expected, responseData.Body, command+" should be refused.")
+	}
+}
+
+func TestFloodingIsRateLimited(t *testing.T) {
+	os.Setenv("MESSAGE_BURST", "2")
+	os.Setenv("MESSAGES_PER_MINUTE", "1")
+	defer func() {
+		os.Unsetenv("MESSAGE_BURST")
+		os.Unsetenv("MESSAGES_PER_MINUTE")
+	}()
+	var responseData EventData
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	_, _, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	_, _, err = ws.ReadMessage()
+	assert.Nil(t, err)
+	jsonResponse, err := json.Marshal(EventData{Event: EventMessage, Body: "spam"})
+	assert.Nil(t, err)
+	for _, expected := range []string{EventMessage, EventMessage, EventErrorNotification} {
+		assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+		_, message, err := ws.ReadMessage()
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(message, &responseData))
+		assert.Equal(t, expected, responseData.Event)
+	}
+}
+
+func TestSlowModeIsKeptPerUserAndChannel(t *testing.T) {
+	setSlowMode("slow", time.Minute)
+	defer setSlowMode("slow", 0)
+	now := time.Now()
+	user := &User{Name: "Renamed", account: "Original", Token: "token", CurrentChannelId: "slow"}
+	mode := getSlowMode("slow")
+	mode.record(slowModeKey(user), now)
+	user.Name = "RenamedAgain"
+	user.CurrentChannelId = ""
+	assert.True(t, getSlowMode("slow").waiting(slowModeKey(user), now.Add(time.Second)), "Renaming or leaving the channel should not reset the wait.")
+	assert.False(t, mode.waiting(slowModeKey(&User{Name: "Other", IP: "10.0.0.1"}), now))
+	assert.False(t, mode.waiting(slowModeKey(user), now.Add(time.Minute)))
+	pruneChannel("slow")
+	if assert.NotNil(t, getSlowMode("slow"), "The slow mode should outlast an empty channel.") {
+		assert.Equal(t, time.Minute, getSlowMode("slow").delay)
+		assert.Empty(t, getSlowMode("slow").lastMessages)
+	}
+}
+
+// readUntil - Reads messages until one matches the event or the read times out.
+func readUntil(t *testing.T, ws *websocket.Conn, event string) EventData {
+	return readUntilBody(t, ws, event, "")
+}
+
+// readUntilBody - Reads messages until one matches the event and the body, if one is given, or the read times out.
+func readUntilBody(t *testing.T, ws *websocket.Conn, event string, body string) EventData {
+	var responseData EventData
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, message, err := ws.ReadMessage()
+		if !assert.Nil(t, err) {
+			return responseData
+		}
+		assert.Nil(t, json.Unmarshal(message, &responseData))
+		if responseData.Event == event && (body == "" || responseData.Body == body) {
+			return responseData
+		}
+	}
+}
+
+func TestIgnoredUserMessagesAreNotDelivered(t *testing.T) {
+	ignorer, server := testSetup(t)
+	ignored, otherServer := testSetup(t)
+	nicknameServer := setupServer("CHAT_CHECK_NICKNAME")
+	defer func() {
+		nicknameServer.Close()
+		ignorer.Close()
+		ignored.Close()
+		server.Close()
+		otherServer.Close()
+	}()
+	readUntil(t, ignorer, EventJoin)
+	ignoredName := readUntil(t, ignored, EventJoin).Body
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "/ignore " + ignoredName})
+	assert.Nil(t, ignorer.WriteMessage(websocket.TextMessage, jsonResponse))
+	readUntilBody(t, ignorer, EventNotification, "You are now ignoring "+ignoredName+".")
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "/nick SomeoneElse"})
+	assert.Nil(t, ignored.WriteMessage(websocket.TextMessage, jsonResponse))
+	readUntil(t, ignored, EventNameChange)
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "can you hear me"})
+	assert.Nil(t, ignored.WriteMessage(websocket.TextMessage, jsonResponse))
+	assert.Equal(t, "can you hear me", readUntil(t, ignored, EventMessage).Body)
+	jsonResponse, _ = json.Marshal(EventData{Event: EventMessage, Body: "quiet in here"})
+	assert.Nil(t, ignorer.WriteMessage(websocket.TextMessage, jsonResponse))
+	assert.Equal(t, "quiet in here", readUntil(t, ignorer, EventMessage).Body)
+}
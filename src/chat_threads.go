@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// replyDTO - The body of a reply event sent by the client.
+type replyDTO struct {
+	ParentId string `json:"parentId"`
+	Body     string `json:"body"`
+	Format   string `json:"format"`
+}
+
+// threadDTO - The body of the thread event sent back to the client.
+type threadDTO struct {
+	Parent  EventData   `json:"parent"`
+	Replies []EventData `json:"replies"`
+}
+
+// threadUpdateDTO - The body of the thread update event broadcast to the channel when a thread gets a new reply.
+type threadUpdateDTO struct {
+	ParentId   string `json:"parentId"`
+	ReplyCount int    `json:"replyCount"`
+}
+
+// threadRoot - Replies to replies go to the thread of the original message.
+func threadRoot(message EventData) (EventData, bool) {
+	if message.ParentId == "" {
+		return message, true
+	}
+	return findChannelMessage(message.ChannelId, message.ParentId)
+}
+
+// saveReplyCount - Stores the reply count of the parent with the history so that it outlives the message cache.
+func saveReplyCount(parent EventData) {
+	jsonResponse, err := json.Marshal(threadUpdateDTO{ParentId: parent.Id, ReplyCount: parent.ReplyCount})
+	if err != nil {
+		log.Print("saveReplyCount():", err)
+		return
+	}
+	go apiRequest("PUT", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_THREAD_URL", nil)
+}
+
+// handleReplyEvent - Sends a chat message as a reply to an earlier message on the current channel.
+func handleReplyEvent(event EventData, user *User) {
+	var reply replyDTO
+	if err := json.Unmarshal([]byte(event.Body), &reply); err != nil || reply.Body == "" {
+		sendSystemMessage("Malformed reply.", user, EventErrorNotification)
+		return
+	}
+	parent, ok := findChannelMessage(user.CurrentChannelId, reply.ParentId)
+	if ok {
+		parent, ok = threadRoot(parent)
+	}
+	if !ok || parent.ChannelId != user.CurrentChannelId {
+		sendSystemMessage(errMessageNotFound.Error(), user, EventErrorNotification)
+		return
+	}
+	format, err := normalizeFormat(reply.Format)
+	if err != nil {
+		sendSystemMessage(err.Error(), user, EventErrorNotification)
+		return
+	}
+	if !checkMessageSize(reply.Body, messageLimit(user), user) {
+		return
+	}
+	messageBody, ok := prepareMessage(reply.Body, format, false, user)
+	if !ok {
+		return
+	}
+	sendChatMessage(user, EventData{Id: newMessageId(), Event: EventMessage, ChannelId: user.CurrentChannelId, Body: messageBody,
+		Name: user.Name, UserCount: UserCount, CreatedDate: time.Now(), ParentId: parent.Id, Format: format})
+	if user.isShadowBanned() {
+		return
+	}
+	// The count comes from the replies themselves so that it is right even when the parent was not cached.
+	parent.ReplyCount = len(getThreadReplies(parent))
+	sentMessages.update(parent.Id, func(message *EventData) error {
+		message.ReplyCount = parent.ReplyCount
+		return nil
+	})
+	saveReplyCount(parent)
+	jsonUpdate, _ := json.Marshal(threadUpdateDTO{ParentId: parent.Id, ReplyCount: parent.ReplyCount})
+	sendEventData(user, EventData{Event: EventThreadUpdate, ChannelId: parent.ChannelId, Body: string(jsonUpdate), Name: SystemName,
+		UserCount: UserCount, CreatedDate: time.Now()}, false, sendToAllOnChannelFilter)
+}
+
+// getThreadReplies - The replies of a thread from the history, with the ones still in the message cache on top.
+func getThreadReplies(parent EventData) []EventData {
+	repliesById := map[string]EventData{}
+	res, err := apiRequest("GET", newApiRequestOptions(&apiRequestOptions{queryString: "?channelId=" + url.QueryEscape(parent.ChannelId) + "&parentId=" + url.QueryEscape(parent.Id)}), "CHAT_THREAD_URL", nil)
+	if err != nil {
+		log.Print("getThreadReplies():", err)
+	} else {
+		var history []EventData
+		if err := json.Unmarshal(res, &history); err != nil {
+			log.Print("getThreadReplies():", err)
+		}
+		for _, reply := range history {
+			if reply.ParentId == parent.Id {
+				repliesById[reply.Id] = reply
+			}
+		}
+	}
+	for _, reply := range sentMessages.find(func(message EventData) bool { return message.ParentId == parent.Id }) {
+		repliesById[reply.Id] = reply
+	}
+	replies := []EventData{}
+	for _, reply := range repliesById {
+		replies = append(replies, reply)
+	}
+	sort.Slice(replies, func(i, j int) bool { return replies[i].CreatedDate.Before(replies[j].CreatedDate) })
+	return replies
+}
+
+// handleThreadEvent - Sends the parent message and all the replies of a thread on the current channel to the user.
+// The body of the event is the id of the parent message.
+func handleThreadEvent(event EventData, user *User) {
+	parent, ok := findChannelMessage(user.CurrentChannelId, event.Body)
+	if !ok {
+		sendSystemMessage(errMessageNotFound.Error(), user, EventErrorNotification)
+		return
+	}
+	replies := getThreadReplies(parent)
+	parent.ReplyCount = len(replies)
+	visible := []EventData{}
+	for _, reply := range replies {
+		if !user.isIgnoringName(reply.Name) {
+			visible = append(visible, reply)
+		}
+	}
+	jsonResponse, err := json.Marshal(threadDTO{Parent: parent, Replies: visible})
+	if err != nil {
+		log.Print("handleThreadEvent():", err)
+		return
+	}
+	sendSystemMessage(string(jsonResponse), user, EventThread)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyUpdatesThread(t *testing.T) {
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+	}()
+	readUntil(t, ws, EventJoin)
+	jsonResponse, _ := json.Marshal(EventData{Event: EventMessage, Body: "start a thread"})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	parent := readUntil(t, ws, EventMessage)
+
+	reply, _ := json.Marshal(replyDTO{ParentId: parent.Id, Body: "a reply"})
+	jsonResponse, _ = json.Marshal(EventData{Event: EventReply, Body: string(reply)})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	message := readUntil(t, ws, EventMessage)
+	assert.Equal(t, parent.Id, message.ParentId)
+
+	reply, _ = json.Marshal(replyDTO{ParentId: message.Id, Body: "a reply to a reply"})
+	jsonResponse, _ = json.Marshal(EventData{Event: EventReply, Body: string(reply)})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	assert.Equal(t, parent.Id, readUntil(t, ws, EventMessage).ParentId, "Replies to replies go to the same thread.")
+	var update threadUpdateDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, ws, EventThreadUpdate).Body), &update))
+	assert.Equal(t, parent.Id, update.ParentId)
+	assert.Equal(t, 2, update.ReplyCount)
+
+	jsonResponse, _ = json.Marshal(EventData{Event: EventThread, Body: parent.Id})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	var thread threadDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, ws, EventThread).Body), &thread))
+	assert.Equal(t, 2, thread.Parent.ReplyCount)
+	assert.Len(t, thread.Replies, 2)
+}
+
+func TestReplyToMessageOutsideTheCache(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("parentId") != "" {
+			fmt.Fprint(w, `[{"id":"old1","parentId":"oldparent","body":"earlier reply"},{"id":"old2","parentId":"oldparent","body":"another"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":"oldparent","event":"message","body":"from before the restart","name":"someone"}]`)
+	}))
+	os.Setenv("CHAT_HISTORY_URL", backend.URL)
+	os.Setenv("CHAT_THREAD_URL", backend.URL)
+	ws, server := testSetup(t)
+	defer func() {
+		server.Close()
+		ws.Close()
+		backend.Close()
+		os.Unsetenv("CHAT_HISTORY_URL")
+		os.Unsetenv("CHAT_THREAD_URL")
+	}()
+	readUntil(t, ws, EventJoin)
+	sentMessages.remove("oldparent")
+
+	reply, _ := json.Marshal(replyDTO{ParentId: "oldparent", Body: "a late reply"})
+	jsonResponse, _ := json.Marshal(EventData{Event: EventReply, Body: string(reply)})
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, jsonResponse))
+	var update threadUpdateDTO
+	assert.Nil(t, json.Unmarshal([]byte(readUntil(t, ws, EventThreadUpdate).Body), &update))
+	assert.Equal(t, 3, update.ReplyCount, "The count includes the replies only the backend has.")
+}
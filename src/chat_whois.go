@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Roles shown in /who and /whois.
+const (
+	RoleAdmin        = "admin"
+	RoleChannelAdmin = "channelAdmin"
+	RoleMember       = "member"
+)
+
+// PresenceOffline - The presence of a registered user who is not connected. Only shown in /whois.
+const PresenceOffline = "offline"
+
+// whoDTO - A user on the channel in the /who output.
+type whoDTO struct {
+	Name           string    `json:"name"`
+	Registered     bool      `json:"registered"`
+	Role           string    `json:"role"`
+	Presence       string    `json:"presence"`
+	Message        string    `json:"message,omitempty"`
+	ConnectedSince time.Time `json:"connectedSince"`
+	IdleSeconds    int       `json:"idleSeconds"`
+}
+
+// accountDTO - The account information of a registered user from the backend.
+type accountDTO struct {
+	Username    string    `json:"username"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+type accountRequestDTO struct {
+	Username string `json:"username"`
+}
+
+// whoisDTO - The profile card of the /whois output.
+type whoisDTO struct {
+	whoDTO
+	Channels []string    `json:"channels"`
+	Account  *accountDTO `json:"account,omitempty"`
+}
+
+// channelRole - The role of the user on the channel whose admin is the given name.
+func channelRole(user *User, channelAdmin string) string {
+	if isAdmin(user) {
+		return RoleAdmin
+	}
+	if !user.isGuest() && channelAdmin != "" && channelAdmin == user.accountName() {
+		return RoleChannelAdmin
+	}
+	return RoleMember
+}
+
+func newWhoDTO(user *User, channelAdmin string) whoDTO {
+	status, message := user.getPresence()
+	return whoDTO{Name: user.Name, Registered: !user.isGuest(), Role: channelRole(user, channelAdmin), Presence: status, Message: message,
+		ConnectedSince: user.connectedSince, IdleSeconds: int(user.idleFor().Seconds())}
+}
+
+// channelAdminName - The admin of the channel, as far as the user can see. The public channel has none.
+func channelAdminName(user *User, channelId string) string {
+	if channelId == "" || user.isGuest() {
+		return ""
+	}
+	channel, err := readChannel(user, channelId)
+	if err != nil {
+		log.Print("channelAdminName():", err)
+		return ""
+	}
+	return channel.Admin
+}
+
+// getAccount - The account information of a registered user. Fails for names that are not registered.
+func getAccount(name string) (*accountDTO, error) {
+	jsonResponse, _ := json.Marshal(accountRequestDTO{Username: name})
+	res, err := apiRequest("POST", newApiRequestOptions(&apiRequestOptions{payload: jsonResponse}), "CHAT_USER_INFO_URL", nil)
+	if err != nil {
+		return nil, err
+	}
+	var account accountDTO
+	if err := json.Unmarshal(res, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// publicChannelsOf - The channels the connections of the user are on that are not private.
+func publicChannelsOf(connections []*User, asker *User) []string {
+	channels := []string{}
+	seen := map[string]bool{}
+	for _, connection := range connections {
+		channelId := connection.CurrentChannelId
+		if seen[channelId] {
+			continue
+		}
+		seen[channelId] = true
+		if channel, ok := visibleChannel(asker, channelId); ok {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// handleWhoisCommand - /whois <nick> shows the profile card of a user. Registered users who are offline are shown too.
+func handleWhoisCommand(params []string, user *User) error {
+	if len(params) != 2 {
+		return notEnoughParameters()
+	}
+	var connections []*User
+	Users.Range(func(key, value interface{}) bool {
+		if target := value.(*User); strings.EqualFold(target.Name, params[1]) {
+			connections = append(connections, target)
+		}
+		return true
+	})
+	var card whoisDTO
+	if len(connections) > 0 {
+		// The connection that was used last tells the presence.
+		sort.Slice(connections, func(i, j int) bool { return connections[i].idleFor() < connections[j].idleFor() })
+		card.whoDTO = newWhoDTO(connections[0], channelAdminName(user, connections[0].CurrentChannelId))
+		card.Channels = publicChannelsOf(connections, user)
+	}
+	if len(connections) == 0 || card.Registered {
+		account, err := getAccount(params[1])
+		if err != nil {
+			if len(connections) == 0 {
+				return errors.New("no such user")
+			}
+			log.Print("handleWhoisCommand():", err)
+		}
+		card.Account = account
+		if len(connections) == 0 {
+			card.whoDTO = whoDTO{Name: account.Username, Registered: true, Role: RoleMember, Presence: PresenceOffline}
+			card.Channels = []string{}
+		}
+	}
+	jsonResponse, err := json.Marshal(card)
+	if err != nil {
+		log.Print("handleWhoisCommand():", err)
+		return genericError()
+	}
+	sendSystemMessage(string(jsonResponse), user, EventWhois)
+	return nil
+}
@@ -6,6 +6,63 @@ const EventTyping = "typing"
 // EventMessage - An event which contains a chat message.
 const EventMessage = "message"
 
+// EventReaction - An event for adding or removing a reaction on a message. Sent back with the reaction counts of the message.
+const EventReaction = "reaction"
+
+// EventReply - An event which contains a chat message that replies to an earlier message.
+const EventReply = "reply"
+
+// EventThread - An event for fetching a thread. Sent back with the parent message and its replies.
+const EventThread = "thread"
+
+// EventThreadUpdate - An event which is sent when a thread gets a new reply.
+const EventThreadUpdate = "threadUpdate"
+
+// EventMention - An event which is sent to a user who is mentioned in a message, on any channel.
+const EventMention = "mention"
+
+// EventDirectMessage - An event which contains a message that only the sender and the recipient see.
+const EventDirectMessage = "directMessage"
+
+// EventInbox - An event which contains the mentions, direct messages and invites a user got while offline.
+const EventInbox = "inbox"
+
+// EventRead - An event for marking everything up to a message as read.
+const EventRead = "read"
+
+// EventReadReceipt - An event which tells the others on a small channel how far a user has read.
+const EventReadReceipt = "readReceipt"
+
+// EventPresence - An event which is sent to a channel when the presence of a user on it changes.
+const EventPresence = "presence"
+
+// EventWhois - An event which contains the profile card of a user.
+const EventWhois = "whois"
+
+// EventSeen - An event which tells when a user was last seen.
+const EventSeen = "seen"
+
+// EventAction - An event which contains an action message, sent with /me.
+const EventAction = "action"
+
+// EventEmojiList - An event which contains the custom emoji of the current channel.
+const EventEmojiList = "emojiList"
+
+// EventLinkPreview - An event which contains the preview of a link in an earlier message.
+const EventLinkPreview = "linkPreview"
+
+// EventMessagePart - An event which contains one part of a long message sent in parts.
+const EventMessagePart = "messagePart"
+
+// EventPins - An event which contains the pinned messages of the current channel.
+const EventPins = "pins"
+
+// EventPinUpdate - An event which is sent to a channel when a message on it is pinned or unpinned.
+const EventPinUpdate = "pinUpdate"
+
+// EventMessageDelete - An event which tells the channel that the message with the id in the body was deleted.
+const EventMessageDelete = "messageDelete"
+
 // EventJoin - An event which is sent when the user joins the chat.
 const EventJoin = "join"
 
@@ -35,6 +92,18 @@ const EventHelp = "helpCommand"
 
 const EventChannelList = "channelList"
 
+// EventIgnoreList - An event that contains the names the user is ignoring.
+const EventIgnoreList = "ignoreList"
+
+// EventShadowBanList - An event that contains the shadow banned names and addresses.
+const EventShadowBanList = "shadowBanList"
+
+// EventBanList - An event that contains the banned addresses.
+const EventBanList = "banList"
+
+// EventModerationQueue - An event that contains the open user reports.
+const EventModerationQueue = "moderationQueue"
+
 const PublicChannelName = "public"
 
 // CommandWhereAmI - What channel are you on.
@@ -54,6 +123,102 @@ const CommandChannel = "channel"
 
 const CommandHelp = "help"
 
+// CommandReport - Report a message to the moderators.
+const CommandReport = "report"
+
+// CommandReports - List and resolve reports. Admins only.
+const CommandReports = "reports"
+
+// CommandKick - Disconnect a user from the chat.
+const CommandKick = "kick"
+
+// CommandDelete - Delete a message.
+const CommandDelete = "delete"
+
+// CommandShadowBan - Hide the messages of a user or an address from everyone but themselves.
+const CommandShadowBan = "shadowban"
+
+// CommandUnshadowBan - Lift a shadow ban.
+const CommandUnshadowBan = "unshadowban"
+
+// CommandBan - Ban the address of a user.
+const CommandBan = "ban"
+
+// CommandUnban - Lift an address ban.
+const CommandUnban = "unban"
+
+// CommandIgnore - Stop seeing anything from a user.
+const CommandIgnore = "ignore"
+
+// CommandUnignore - Start seeing a previously ignored user again.
+const CommandUnignore = "unignore"
+
+// CommandInbox - List what came in while offline or mark it as read.
+const CommandInbox = "inbox"
+
+// CommandDirectMessage - Send a message that only one user sees.
+const CommandDirectMessage = "msg"
+
+// CommandAway - Set yourself away, with an optional message.
+const CommandAway = "away"
+
+// CommandBusy - Set yourself busy.
+const CommandBusy = "busy"
+
+// CommandBack - Clear away or busy.
+const CommandBack = "back"
+
+// CommandWhois - Show the profile of a user.
+const CommandWhois = "whois"
+
+// CommandSeen - Ask when a user was last seen.
+const CommandSeen = "seen"
+
+// CommandMe - Send an action message.
+const CommandMe = "me"
+
+// CommandPin - Pin a message on the current channel.
+const CommandPin = "pin"
+
+// CommandUnpin - Unpin a message.
+const CommandUnpin = "unpin"
+
+// CommandPins - List the pinned messages of the current channel.
+const CommandPins = "pins"
+
 const SystemName = ""
 
 const ErrorCodeCommandNotRecognized = "0"
+
+// ErrorCodeBadRequest - The request was malformed or its parameters were invalid.
+const ErrorCodeBadRequest = "1"
+
+// ErrorCodeUnauthorized - The credentials were not accepted.
+const ErrorCodeUnauthorized = "2"
+
+// ErrorCodeTooManyAttempts - Too many failed attempts. The caller is locked out for a while.
+const ErrorCodeTooManyAttempts = "3"
+
+// ErrorCodeLoginFailed - The login went through but the user information could not be fetched.
+const ErrorCodeLoginFailed = "4"
+
+// ErrorCodeOriginNotAllowed - The request came from an origin that is not allowed by the origin policy.
+const ErrorCodeOriginNotAllowed = "5"
+
+// ErrorCodeInvalidCSRFToken - The request carried a session cookie but no matching csrf token.
+const ErrorCodeInvalidCSRFToken = "6"
+
+// ErrorCodeForbidden - The user is logged in but not allowed to do that.
+const ErrorCodeForbidden = "7"
+
+// ErrorCodeNotFound - The requested thing does not exist.
+const ErrorCodeNotFound = "8"
+
+// ErrorCodeTooLarge - The request or the file in it was too large.
+const ErrorCodeTooLarge = "9"
+
+// ErrorCodeUnsupportedType - Files of that type are not accepted.
+const ErrorCodeUnsupportedType = "10"
+
+// ErrorCodeServerError - Something went wrong on the server. Trying again later may help.
+const ErrorCodeServerError = "11"
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,7 +13,9 @@ import (
 const (
 	pingWait       = 10 * time.Second
 	pongWait       = 60 * time.Second
-	maxMessageSize = 512
+	// maxFrameSize - The largest websocket frame the chat reads. Larger frames close the connection.
+	// Messages have limits of their own well below this. See messageSizePolicy.
+	maxFrameSize = 64 * 1024
 )
 
 func initEnvFile() {
@@ -23,14 +26,37 @@ func initEnvFile() {
 	log.Print("initEnvFile():", "Loaded envs.")
 }
 
+// getEnvInt - Reads an integer env variable, falling back to the given default when it is missing or invalid.
+func getEnvInt(name string, fallback int) int {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Print("getEnvInt():", name, " is not a number. Using default.")
+		return fallback
+	}
+	return parsed
+}
+
 func initRoutes() {
 	http.HandleFunc("/api/v1/ws/chat", chatRequest)
-	http.HandleFunc("/api/v1/http/chat/login", loginRequest)
+	// Login is authenticated by the credentials, not the session, and it is where a session without a csrf cookie gets one.
+	http.HandleFunc("/api/v1/http/chat/login", withCORS(loginRequest))
+	http.HandleFunc("/api/v1/http/chat/moderation/reports", withCORS(withCSRF(moderationReportsRequest)))
+	http.HandleFunc("/api/v1/http/chat/moderation/reports/resolve", withCORS(withCSRF(moderationResolveRequest)))
+	http.HandleFunc("/api/v1/http/chat/attachments", withCORS(withCSRF(uploadRequest)))
+	http.HandleFunc(attachmentsPath, withCORS(downloadRequest))
 	log.Print("initRoutes():", "Routes initialized.")
 }
 
 func main() {
 	initEnvFile()
+	initLoginLimiters()
+	initShadowBans()
+	initIPPolicy()
+	initAttachments()
 	initRoutes()
 	log.Print("main():", "Starting server on port: " + os.Getenv("PORT"))
 	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/gorilla/websocket"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,9 +11,38 @@ import (
 type User struct {
 	Name             string
 	Token            string
+	account          string
 	Connection       *websocket.Conn
 	mutex            sync.Mutex
 	CurrentChannelId string
+	IP               string
+	shadowBanned     atomic.Bool
+	messageBucket    *tokenBucket
+	flood            floodState
+	recentMessages   []recentMessage
+	ignoreMutex      sync.RWMutex
+	ignored          map[string]bool
+	ignoredGuests    map[*User]bool
+	inboxOnce        sync.Once
+	readMutex        sync.Mutex
+	lastRead         map[string]readPosition
+	presence         presenceState
+	connectedSince   time.Time
+	partialMessage   *partialMessage
+}
+
+// isGuest - Guests are users that have not logged in.
+func (u *User) isGuest() bool {
+	return len(u.Token) == 0
+}
+
+// accountName - The name the user logged in with, or for guests the name they connected with. Changing the nick
+// does not change it.
+func (u *User) accountName() string {
+	if u.account == "" {
+		return u.Name
+	}
+	return u.account
 }
 
 func (u *User) write(messageType int, data []byte) error {